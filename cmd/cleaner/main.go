@@ -1,65 +1,140 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"scaler/internal/scaling/cleaner"
 	"scaler/internal/vmss"
+	"scaler/pkg/appconfig"
 	"scaler/pkg/config"
+	"scaler/pkg/leader"
+	"scaler/pkg/logging"
 	"scaler/pkg/monitoring"
 	"scaler/pkg/redis"
+	"scaler/pkg/routing"
+	"scaler/pkg/tracing"
 )
 
 func main() {
-	// Load configs
-	redisConfig, err := config.LoadRedisConfig()
-	if err != nil {
-		log.Fatalf("Failed to load Redis config: %v", err)
+	// Load configs, every invalid setting is reported at once
+	var loader config.Loader
+	loggingConfig := loader.Logging()
+	redisConfig := loader.Redis()
+	vmssConfig := loader.VMSS()
+	scalerConfig := loader.Scaler()
+	appgwConfig := loader.AppGW()
+	routingConfig := loader.Routing()
+	tracingConfig := loader.Tracing()
+	telemetryConfig := loader.Telemetry()
+	if loggingConfig != nil {
+		loader.Add(logging.Setup(loggingConfig, "cleaner"))
 	}
-
-	vmssConfig, err := config.LoadVMSSConfig()
-	if err != nil {
-		log.Fatalf("Failed to load VMSS config: %v", err)
+	if err := loader.Err(); err != nil {
+		logging.Fatal("Invalid configuration", logging.Err(err))
 	}
 
-	scalerConfig, err := config.LoadScalerConfig()
+	shutdownTracing, err := tracing.Init(context.Background(), tracingConfig, "cleaner")
 	if err != nil {
-		log.Fatalf("Failed to load Scaler config: %v", err)
+		logging.Fatal("Failed to initialize tracing", logging.Err(err))
 	}
 
 	// Create clients
 	redisClient, err := redis.NewClient(redisConfig)
 	if err != nil {
-		log.Fatalf("Failed to create Redis client: %v", err)
+		logging.Fatal("Failed to create Redis client", logging.Err(err))
 	}
 	defer redisClient.Close()
 
-	vmssProvider, err := vmss.NewAzureVMSSProvider(vmssConfig)
+	// Expose Prometheus metrics
+	if err := monitoring.RegisterPoolCollector(redisClient); err != nil {
+		logging.Fatal("Failed to register pool metrics", logging.Err(err))
+	}
+	metricsServer, err := monitoring.ServeMetrics(scalerConfig.MetricsAddr)
+	if err != nil {
+		logging.Fatal("Failed to serve metrics", logging.Err(err))
+	}
+
+	// Campaign for leadership so only one replica performs mutations
+	elector, err := leader.NewElector(redisClient, "cleaner", time.Duration(scalerConfig.LeaseTTL)*time.Second)
+	if err != nil {
+		logging.Fatal("Failed to create leader elector", logging.Err(err))
+	}
+
+	if err := elector.Start(); err != nil {
+		logging.Fatal("Failed to start leader election", logging.Err(err))
+	}
+
+	azureVMSS, err := vmss.NewAzureVMSSProvider(vmssConfig)
+	if err != nil {
+		logging.Fatal("Failed to create VMSS provider", logging.Err(err))
+	}
+
+	router, err := routing.NewRouter(routingConfig, appgwConfig)
+	if err != nil {
+		logging.Fatal("Failed to create router", logging.Err(err))
+	}
+	router = leader.FenceRouter(router, redisClient)
+
+	sinks, err := monitoring.NewSinks(telemetryConfig, vmssConfig.InstrumentationKey)
 	if err != nil {
-		log.Fatalf("Failed to create VMSS provider: %v", err)
+		logging.Fatal("Failed to create telemetry sinks", logging.Err(err))
+	}
+	monitor := monitoring.NewMonitor(sinks...)
+
+	// Report ARM and Redis calls as dependencies
+	vmssProvider := monitoring.InstrumentVMSS(azureVMSS, monitor, vmssConfig.ScaleSetName)
+
+	// A deposed leader must not act on the scale set
+	vmssProvider = leader.FenceVMSS(vmssProvider, redisClient)
+	redisClient.Observe(monitoring.RedisObserver(monitor, redisConfig.Host))
+
+	// App Config is optional, without it the tunables keep their startup values and every
+	// feature flag uses its default
+	var appConfigProvider appconfig.Provider
+	var features *appconfig.Features
+	var sentinelKey string
+	var refreshInterval time.Duration
+	if appConfigConfig, err := config.LoadAppConfigConfig(); err != nil {
+		slog.Warn("App Configuration not configured, using startup settings and default feature flags", logging.Err(err))
+	} else if provider, err := appconfig.NewProvider(appConfigConfig); err != nil {
+		slog.Warn("Failed to create App Configuration provider, using startup settings and default feature flags", logging.Err(err))
+	} else {
+		appConfigProvider = provider
+		sentinelKey = appConfigConfig.SentinelKey
+		refreshInterval = time.Duration(appConfigConfig.RefreshInterval) * time.Second
+		features = appconfig.NewFeatures(provider, refreshInterval)
 	}
 
-	monitor, err := monitoring.NewMonitor(vmssConfig.InstrumentationKey)
+	settings, err := appconfig.NewWatcher(appConfigProvider, sentinelKey, refreshInterval, scalerConfig)
 	if err != nil {
-		log.Fatalf("Failed to create monitoring client: %v", err)
+		logging.Fatal("Failed to create App Configuration watcher", logging.Err(err))
 	}
 
+	settings.Start()
+	defer settings.Stop()
+
 	// Create and start service
 	svc, err := cleaner.NewService(
 		vmssProvider,
+		router,
 		redisClient,
 		monitor,
 		scalerConfig,
+		elector,
+		settings,
+		features,
 	)
 	if err != nil {
-		log.Fatalf("Failed to create cleaner service: %v", err)
+		logging.Fatal("Failed to create cleaner service", logging.Err(err))
 	}
 
 	if err := svc.Start(); err != nil {
-		log.Fatalf("Failed to start cleaner service: %v", err)
+		logging.Fatal("Failed to start cleaner service", logging.Err(err))
 	}
 
 	// Wait for termination signal
@@ -67,7 +142,33 @@ func main() {
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
 
-	if err := svc.Stop(); err != nil {
-		log.Printf("Error during shutdown: %v", err)
+	// Give in-flight work the configured grace period to finish
+	slog.Info("Shutting down, waiting for in-flight work", "graceSeconds", scalerConfig.ShutdownGrace)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(scalerConfig.ShutdownGrace)*time.Second)
+	defer cancel()
+
+	if err := svc.Stop(ctx); err != nil {
+		slog.Error("Error during shutdown", logging.Err(err))
+	}
+
+	// Hand leadership over to a standby replica
+	if err := elector.Stop(); err != nil {
+		slog.Error("Error releasing leadership", logging.Err(err))
+	}
+
+	// Flush with a timeout of its own, a slow drain may have used up the grace period and
+	// the telemetry of abandoned runs is the most needed
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), monitoring.FlushTimeout)
+	defer cancelFlush()
+
+	monitoring.ShutdownMetrics(flushCtx, metricsServer)
+
+	if err := monitor.Close(flushCtx); err != nil {
+		slog.Error("Error flushing telemetry", logging.Err(err))
+	}
+
+	// Flush buffered spans
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("Error flushing traces", logging.Err(err))
 	}
 }
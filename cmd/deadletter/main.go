@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"scaler/internal/scaling/deadletter"
+	"scaler/internal/vmss"
+	"scaler/pkg/config"
+	"scaler/pkg/logging"
+	"scaler/pkg/redis"
+)
+
+const usage = `Usage:
+  deadletter list
+  deadletter requeue [-status Reserved|Available] [-all] [key ...]
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// Load configs, every invalid setting is reported at once
+	var loader config.Loader
+	loggingConfig := loader.Logging()
+	redisConfig := loader.Redis()
+	scalerConfig := loader.Scaler()
+	if loggingConfig != nil {
+		loader.Add(logging.Setup(loggingConfig, "deadletter"))
+	}
+	if err := loader.Err(); err != nil {
+		logging.Fatal("Invalid configuration", logging.Err(err))
+	}
+
+	// Create clients
+	redisClient, err := redis.NewClient(redisConfig)
+	if err != nil {
+		logging.Fatal("Failed to create Redis client", logging.Err(err))
+	}
+	defer redisClient.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(scalerConfig.JobTimeout)*time.Second)
+	defer cancel()
+
+	switch os.Args[1] {
+	case "list":
+		err = list(ctx, redisClient)
+	case "requeue":
+		err = requeue(ctx, redisClient, scalerConfig, os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		logging.Fatal("Failed to process dead-lettered instances", "command", os.Args[1], logging.Err(err))
+	}
+}
+
+func list(ctx context.Context, redisClient redis.Client) error {
+	entries, err := deadletter.List(ctx, redisClient)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tINSTANCE\tATTEMPTS\tUPDATED\tLAST ERROR")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n",
+			entry.Key, entry.Record.InstanceID, entry.Record.Attempts, entry.Record.UpdatedAt, entry.Record.LastError)
+	}
+	return w.Flush()
+}
+
+func requeue(ctx context.Context, redisClient redis.Client, scalerConfig *config.ScalerConfig, args []string) error {
+	flags := flag.NewFlagSet("requeue", flag.ExitOnError)
+	status := flags.String("status", string(vmss.VMStatusReserved), "status to requeue instances to (Reserved or Available)")
+	all := flags.Bool("all", false, "requeue every dead-lettered instance")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	instances := flags.Args()
+	if *all {
+		entries, err := deadletter.List(ctx, redisClient)
+		if err != nil {
+			return err
+		}
+		instances = instances[:0]
+		for _, entry := range entries {
+			instances = append(instances, entry.Key)
+		}
+	}
+
+	if len(instances) == 0 {
+		return fmt.Errorf("no instances given, pass keys or -all")
+	}
+
+	owner := redis.NewOwnerID("deadletter")
+	lockTTL := time.Duration(scalerConfig.LockTTL) * time.Second
+
+	failed := 0
+	for _, instance := range instances {
+		if err := deadletter.Requeue(ctx, redisClient, owner, lockTTL, instance, vmss.VMStatus(*status)); err != nil {
+			slog.Error("Error requeueing instance", "key", instance, logging.Err(err))
+			failed++
+			continue
+		}
+		slog.Info("Requeued instance", "key", instance, "status", *status)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d instances could not be requeued", failed, len(instances))
+	}
+	return nil
+}
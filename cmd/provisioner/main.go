@@ -1,76 +1,157 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"scaler/internal/scaling/provisioner"
 	"scaler/internal/vmss"
 	"scaler/pkg/appconfig"
-	"scaler/pkg/appgw"
 	"scaler/pkg/config"
+	"scaler/pkg/leader"
+	"scaler/pkg/logging"
 	"scaler/pkg/monitoring"
+	"scaler/pkg/redis"
+	"scaler/pkg/routing"
+	"scaler/pkg/tracing"
 )
 
 func main() {
-	// Load configs
-	vmssConfig, err := config.LoadVMSSConfig()
+	// Load configs, every invalid setting is reported at once
+	var loader config.Loader
+	loggingConfig := loader.Logging()
+	redisConfig := loader.Redis()
+	vmssConfig := loader.VMSS()
+	appgwConfig := loader.AppGW()
+	routingConfig := loader.Routing()
+	tracingConfig := loader.Tracing()
+	telemetryConfig := loader.Telemetry()
+	if loggingConfig != nil {
+		loader.Add(logging.Setup(loggingConfig, "provisioner"))
+	}
+
+	// App Config is optional and its values override env vars for the scaler settings, without it
+	// the tunables keep their startup values and the feature flags their defaults
+	var appConfigProvider appconfig.Provider
+	var appConfigSource *appconfig.Source
+	var scalerSources []config.Source
+	var sentinelKey string
+	var refreshInterval time.Duration
+	if appConfigConfig, err := config.LoadAppConfigConfig(); err != nil {
+		slog.Warn("App Configuration not configured, using startup settings", logging.Err(err))
+	} else if provider, err := appconfig.NewProvider(appConfigConfig); err != nil {
+		slog.Warn("Failed to create App Configuration provider, using startup settings", logging.Err(err))
+	} else {
+		appConfigProvider = provider
+		sentinelKey = appConfigConfig.SentinelKey
+		refreshInterval = time.Duration(appConfigConfig.RefreshInterval) * time.Second
+	}
+
+	loadCtx, cancelLoad := context.WithTimeout(context.Background(), 30*time.Second)
+	if appConfigProvider != nil {
+		appConfigSource = appconfig.NewSource(loadCtx, appConfigProvider)
+		scalerSources = append(scalerSources, appConfigSource)
+	}
+	scalerConfig, report := loader.ScalerFrom(scalerSources...)
+	cancelLoad()
+
+	if err := loader.Err(); err != nil {
+		logging.Fatal("Invalid configuration", logging.Err(err))
+	}
+
+	if appConfigSource != nil {
+		if err := appConfigSource.Err(); err != nil {
+			slog.Warn("Failed to read some App Config keys, using lower precedence sources", logging.Err(err))
+		}
+	}
+	slog.Info("Effective scaler config", "config", report)
+
+	shutdownTracing, err := tracing.Init(context.Background(), tracingConfig, "provisioner")
 	if err != nil {
-		log.Fatalf("Failed to load VMSS config: %v", err)
+		logging.Fatal("Failed to initialize tracing", logging.Err(err))
 	}
 
-	appgwConfig, err := config.LoadAppGWConfig()
+	// Create clients
+	redisClient, err := redis.NewClient(redisConfig)
 	if err != nil {
-		log.Fatalf("Failed to load AppGW config: %v", err)
+		logging.Fatal("Failed to create Redis client", logging.Err(err))
 	}
+	defer redisClient.Close()
 
-	scalerConfig, err := config.LoadScalerConfig()
+	// Expose Prometheus metrics
+	if err := monitoring.RegisterPoolCollector(redisClient); err != nil {
+		logging.Fatal("Failed to register pool metrics", logging.Err(err))
+	}
+	metricsServer, err := monitoring.ServeMetrics(scalerConfig.MetricsAddr)
 	if err != nil {
-		log.Fatalf("Failed to load Scaler config: %v", err)
+		logging.Fatal("Failed to serve metrics", logging.Err(err))
 	}
 
-	appConfigConfig, err := config.LoadAppConfigConfig()
+	// Campaign for leadership so only one replica performs mutations
+	elector, err := leader.NewElector(redisClient, "provisioner", time.Duration(scalerConfig.LeaseTTL)*time.Second)
 	if err != nil {
-		log.Fatalf("Failed to load App Configuration: %v", err)
+		logging.Fatal("Failed to create leader elector", logging.Err(err))
 	}
 
-	// Create clients
-	vmssProvider, err := vmss.NewAzureVMSSProvider(vmssConfig)
+	if err := elector.Start(); err != nil {
+		logging.Fatal("Failed to start leader election", logging.Err(err))
+	}
+
+	azureVMSS, err := vmss.NewAzureVMSSProvider(vmssConfig)
 	if err != nil {
-		log.Fatalf("Failed to create VMSS provider: %v", err)
+		logging.Fatal("Failed to create VMSS provider", logging.Err(err))
 	}
 
-	appGWProvider, err := appgw.NewAzureAppGWProvider(appgwConfig)
+	router, err := routing.NewRouter(routingConfig, appgwConfig)
 	if err != nil {
-		log.Fatalf("Failed to create AppGW provider: %v", err)
+		logging.Fatal("Failed to create router", logging.Err(err))
 	}
+	router = leader.FenceRouter(router, redisClient)
 
-	monitor, err := monitoring.NewMonitor(vmssConfig.InstrumentationKey)
+	sinks, err := monitoring.NewSinks(telemetryConfig, vmssConfig.InstrumentationKey)
 	if err != nil {
-		log.Fatalf("Failed to create monitoring client: %v", err)
+		logging.Fatal("Failed to create telemetry sinks", logging.Err(err))
 	}
+	monitor := monitoring.NewMonitor(sinks...)
+
+	// Report ARM and Redis calls as dependencies
+	vmssProvider := monitoring.InstrumentVMSS(azureVMSS, monitor, vmssConfig.ScaleSetName)
 
-	appConfigProvider, err := appconfig.NewAzureAppConfigProvider(appConfigConfig)
+	// A deposed leader must not act on the scale set
+	vmssProvider = leader.FenceVMSS(vmssProvider, redisClient)
+	redisClient.Observe(monitoring.RedisObserver(monitor, redisConfig.Host))
+
+	// Keep the tunables in sync with App Config, falling back to the startup config
+	settings, err := appconfig.NewWatcher(appConfigProvider, sentinelKey, refreshInterval, scalerConfig)
 	if err != nil {
-		log.Fatalf("Failed to create App Configuration provider: %v", err)
+		logging.Fatal("Failed to create App Configuration watcher", logging.Err(err))
 	}
 
+	settings.Start()
+	defer settings.Stop()
+
+	features := appconfig.NewFeatures(appConfigProvider, refreshInterval)
+
 	// Create and start service
 	svc, err := provisioner.NewService(
 		vmssProvider,
-		appGWProvider,
+		router,
 		monitor,
 		scalerConfig,
-		appConfigProvider,
+		elector,
+		settings,
+		features,
 	)
 	if err != nil {
-		log.Fatalf("Failed to create provisioner service: %v", err)
+		logging.Fatal("Failed to create provisioner service", logging.Err(err))
 	}
 
 	if err := svc.Start(); err != nil {
-		log.Fatalf("Failed to start provisioner service: %v", err)
+		logging.Fatal("Failed to start provisioner service", logging.Err(err))
 	}
 
 	// Wait for termination signal
@@ -78,7 +159,33 @@ func main() {
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
 
-	if err := svc.Stop(); err != nil {
-		log.Printf("Error during shutdown: %v", err)
+	// Give in-flight work the configured grace period to finish
+	slog.Info("Shutting down, waiting for in-flight work", "graceSeconds", scalerConfig.ShutdownGrace)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(scalerConfig.ShutdownGrace)*time.Second)
+	defer cancel()
+
+	if err := svc.Stop(ctx); err != nil {
+		slog.Error("Error during shutdown", logging.Err(err))
+	}
+
+	// Hand leadership over to a standby replica
+	if err := elector.Stop(); err != nil {
+		slog.Error("Error releasing leadership", logging.Err(err))
+	}
+
+	// Flush with a timeout of its own, a slow drain may have used up the grace period and
+	// the telemetry of abandoned runs is the most needed
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), monitoring.FlushTimeout)
+	defer cancelFlush()
+
+	monitoring.ShutdownMetrics(flushCtx, metricsServer)
+
+	if err := monitor.Close(flushCtx); err != nil {
+		slog.Error("Error flushing telemetry", logging.Err(err))
+	}
+
+	// Flush buffered spans
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("Error flushing traces", logging.Err(err))
 	}
 }
@@ -1,44 +1,83 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"scaler/internal/scaling/reconciler"
 	"scaler/internal/vmss"
+	"scaler/pkg/appconfig"
 	"scaler/pkg/config"
+	"scaler/pkg/leader"
+	"scaler/pkg/logging"
+	"scaler/pkg/monitoring"
 	"scaler/pkg/redis"
+	"scaler/pkg/tracing"
 )
 
 func main() {
-	// Load configs
-	redisConfig, err := config.LoadRedisConfig()
-	if err != nil {
-		log.Fatalf("Failed to load Redis config: %v", err)
+	// Load configs, every invalid setting is reported at once
+	var loader config.Loader
+	loggingConfig := loader.Logging()
+	redisConfig := loader.Redis()
+	vmssConfig := loader.VMSS()
+	scalerConfig := loader.Scaler()
+	tracingConfig := loader.Tracing()
+	if loggingConfig != nil {
+		loader.Add(logging.Setup(loggingConfig, "reconciler"))
 	}
-
-	vmssConfig, err := config.LoadVMSSConfig()
-	if err != nil {
-		log.Fatalf("Failed to load VMSS config: %v", err)
+	if err := loader.Err(); err != nil {
+		logging.Fatal("Invalid configuration", logging.Err(err))
 	}
 
-	scalerConfig, err := config.LoadScalerConfig()
+	shutdownTracing, err := tracing.Init(context.Background(), tracingConfig, "reconciler")
 	if err != nil {
-		log.Fatalf("Failed to load Scaler config: %v", err)
+		logging.Fatal("Failed to initialize tracing", logging.Err(err))
 	}
 
 	// Create clients
 	redisClient, err := redis.NewClient(redisConfig)
 	if err != nil {
-		log.Fatalf("Failed to create Redis client: %v", err)
+		logging.Fatal("Failed to create Redis client", logging.Err(err))
 	}
 	defer redisClient.Close()
 
+	// Expose Prometheus metrics
+	if err := monitoring.RegisterPoolCollector(redisClient); err != nil {
+		logging.Fatal("Failed to register pool metrics", logging.Err(err))
+	}
+	metricsServer, err := monitoring.ServeMetrics(scalerConfig.MetricsAddr)
+	if err != nil {
+		logging.Fatal("Failed to serve metrics", logging.Err(err))
+	}
+
+	// Campaign for leadership so only one replica performs mutations
+	elector, err := leader.NewElector(redisClient, "reconciler", time.Duration(scalerConfig.LeaseTTL)*time.Second)
+	if err != nil {
+		logging.Fatal("Failed to create leader elector", logging.Err(err))
+	}
+
+	if err := elector.Start(); err != nil {
+		logging.Fatal("Failed to start leader election", logging.Err(err))
+	}
+
 	vmssProvider, err := vmss.NewAzureVMSSProvider(vmssConfig)
 	if err != nil {
-		log.Fatalf("Failed to create VMSS provider: %v", err)
+		logging.Fatal("Failed to create VMSS provider", logging.Err(err))
+	}
+
+	// Feature flags are optional, without App Config every flag uses its default
+	var features *appconfig.Features
+	if appConfigConfig, err := config.LoadAppConfigConfig(); err != nil {
+		slog.Warn("App Configuration not configured, feature flags use defaults", logging.Err(err))
+	} else if appConfigProvider, err := appconfig.NewProvider(appConfigConfig); err != nil {
+		slog.Warn("Failed to create App Configuration provider, feature flags use defaults", logging.Err(err))
+	} else {
+		features = appconfig.NewFeatures(appConfigProvider, time.Duration(appConfigConfig.RefreshInterval)*time.Second)
 	}
 
 	// Create and start service
@@ -46,13 +85,15 @@ func main() {
 		vmssProvider,
 		redisClient,
 		scalerConfig,
+		elector,
+		features,
 	)
 	if err != nil {
-		log.Fatalf("Failed to create reconciler service: %v", err)
+		logging.Fatal("Failed to create reconciler service", logging.Err(err))
 	}
 
 	if err := svc.Start(); err != nil {
-		log.Fatalf("Failed to start reconciler service: %v", err)
+		logging.Fatal("Failed to start reconciler service", logging.Err(err))
 	}
 
 	// Wait for termination signal
@@ -60,7 +101,29 @@ func main() {
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
 
-	if err := svc.Stop(); err != nil {
-		log.Printf("Error during shutdown: %v", err)
+	// Give in-flight work the configured grace period to finish
+	slog.Info("Shutting down, waiting for in-flight work", "graceSeconds", scalerConfig.ShutdownGrace)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(scalerConfig.ShutdownGrace)*time.Second)
+	defer cancel()
+
+	if err := svc.Stop(ctx); err != nil {
+		slog.Error("Error during shutdown", logging.Err(err))
+	}
+
+	// Hand leadership over to a standby replica
+	if err := elector.Stop(); err != nil {
+		slog.Error("Error releasing leadership", logging.Err(err))
+	}
+
+	// Flush with a timeout of its own, a slow drain may have used up the grace period and
+	// the telemetry of abandoned runs is the most needed
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), monitoring.FlushTimeout)
+	defer cancelFlush()
+
+	monitoring.ShutdownMetrics(flushCtx, metricsServer)
+
+	// Flush buffered spans
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("Error flushing traces", logging.Err(err))
 	}
 }
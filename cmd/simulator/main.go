@@ -1,46 +1,102 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"scaler/internal/scaling/simulator"
 	"scaler/pkg/config"
+	"scaler/pkg/leader"
+	"scaler/pkg/logging"
+	"scaler/pkg/monitoring"
 	"scaler/pkg/redis"
+	"scaler/pkg/session"
+	"scaler/pkg/tracing"
 )
 
 func main() {
-	// Load configs
-	redisConfig, err := config.LoadRedisConfig()
-	if err != nil {
-		log.Fatalf("Failed to load Redis config: %v", err)
+	// Load configs, every invalid setting is reported at once
+	var loader config.Loader
+	loggingConfig := loader.Logging()
+	redisConfig := loader.Redis()
+	scalerConfig := loader.Scaler()
+	sessionConfig := loader.Session()
+	tracingConfig := loader.Tracing()
+	if loggingConfig != nil {
+		loader.Add(logging.Setup(loggingConfig, "simulator"))
+	}
+	if err := loader.Err(); err != nil {
+		logging.Fatal("Invalid configuration", logging.Err(err))
 	}
 
-	scalerConfig, err := config.LoadScalerConfig()
+	shutdownTracing, err := tracing.Init(context.Background(), tracingConfig, "simulator")
 	if err != nil {
-		log.Fatalf("Failed to load Scaler config: %v", err)
+		logging.Fatal("Failed to initialize tracing", logging.Err(err))
 	}
 
 	// Create clients
 	redisClient, err := redis.NewClient(redisConfig)
 	if err != nil {
-		log.Fatalf("Failed to create Redis client: %v", err)
+		logging.Fatal("Failed to create Redis client", logging.Err(err))
 	}
 	defer redisClient.Close()
 
+	// Expose Prometheus metrics
+	if err := monitoring.RegisterPoolCollector(redisClient); err != nil {
+		logging.Fatal("Failed to register pool metrics", logging.Err(err))
+	}
+	metricsServer, err := monitoring.ServeMetrics(scalerConfig.MetricsAddr)
+	if err != nil {
+		logging.Fatal("Failed to serve metrics", logging.Err(err))
+	}
+
+	// Campaign for leadership so only one replica performs mutations
+	elector, err := leader.NewElector(redisClient, "simulator", time.Duration(scalerConfig.LeaseTTL)*time.Second)
+	if err != nil {
+		logging.Fatal("Failed to create leader elector", logging.Err(err))
+	}
+
+	if err := elector.Start(); err != nil {
+		logging.Fatal("Failed to start leader election", logging.Err(err))
+	}
+
+	// Session tokens are only issued when a signing secret is configured
+	var signer *session.Signer
+	if sessionConfig.TokenSecret != "" {
+		signer, err = session.NewSigner(sessionConfig.TokenSecret, sessionConfig.TokenIssuer,
+			time.Duration(sessionConfig.TokenTTL)*time.Second)
+		if err != nil {
+			logging.Fatal("Failed to create session token signer", logging.Err(err))
+		}
+	}
+
+	// TURN credentials are only issued when a coturn shared secret is configured
+	var turn *session.TURNIssuer
+	if sessionConfig.TURNSecret != "" {
+		turn, err = session.NewTURNIssuer(sessionConfig.TURNSecret)
+		if err != nil {
+			logging.Fatal("Failed to create TURN credential issuer", logging.Err(err))
+		}
+	}
+
 	// Create and start service
 	svc, err := simulator.NewService(
 		redisClient,
 		scalerConfig,
+		elector,
+		signer,
+		turn,
 	)
 	if err != nil {
-		log.Fatalf("Failed to create simulator service: %v", err)
+		logging.Fatal("Failed to create simulator service", logging.Err(err))
 	}
 
 	if err := svc.Start(); err != nil {
-		log.Fatalf("Failed to start simulator service: %v", err)
+		logging.Fatal("Failed to start simulator service", logging.Err(err))
 	}
 
 	// Wait for termination signal
@@ -48,7 +104,29 @@ func main() {
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
 
-	if err := svc.Stop(); err != nil {
-		log.Printf("Error during shutdown: %v", err)
+	// Give in-flight work the configured grace period to finish
+	slog.Info("Shutting down, waiting for in-flight work", "graceSeconds", scalerConfig.ShutdownGrace)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(scalerConfig.ShutdownGrace)*time.Second)
+	defer cancel()
+
+	if err := svc.Stop(ctx); err != nil {
+		slog.Error("Error during shutdown", logging.Err(err))
+	}
+
+	// Hand leadership over to a standby replica
+	if err := elector.Stop(); err != nil {
+		slog.Error("Error releasing leadership", logging.Err(err))
+	}
+
+	// Flush with a timeout of its own, a slow drain may have used up the grace period and
+	// the telemetry of abandoned runs is the most needed
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), monitoring.FlushTimeout)
+	defer cancelFlush()
+
+	monitoring.ShutdownMetrics(flushCtx, metricsServer)
+
+	// Flush buffered spans
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("Error flushing traces", logging.Err(err))
 	}
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"scaler/pkg/config"
+	"scaler/pkg/logging"
+	"scaler/pkg/monitoring"
+	"scaler/pkg/redis"
+	"scaler/pkg/session"
+)
+
+func main() {
+	// Load configs, every invalid setting is reported at once
+	var loader config.Loader
+	loggingConfig := loader.Logging()
+	redisConfig := loader.Redis()
+	scalerConfig := loader.Scaler()
+	sessionConfig := loader.Session()
+	if loggingConfig != nil {
+		loader.Add(logging.Setup(loggingConfig, "verifier"))
+	}
+	if err := loader.Err(); err != nil {
+		logging.Fatal("Invalid configuration", logging.Err(err))
+	}
+
+	signer, err := session.NewSigner(sessionConfig.TokenSecret, sessionConfig.TokenIssuer,
+		time.Duration(sessionConfig.TokenTTL)*time.Second)
+	if err != nil {
+		logging.Fatal("Failed to create session token signer", logging.Err(err))
+	}
+
+	// Tokens are checked against the instance records so ended sessions are revoked
+	redisClient, err := redis.NewClient(redisConfig)
+	if err != nil {
+		logging.Fatal("Failed to create Redis client", logging.Err(err))
+	}
+	defer redisClient.Close()
+
+	verifier, err := session.NewVerifier(signer, redisClient, sessionConfig.TrustedProxies, sessionConfig.TrustedProxyCIDRs)
+	if err != nil {
+		logging.Fatal("Failed to create session token verifier", logging.Err(err))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/verify", verifier.Handler())
+	mux.Handle("/metrics", monitoring.MetricsHandler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := &http.Server{
+		Addr:              sessionConfig.VerifyAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		slog.Info("Session token verifier listening", "addr", sessionConfig.VerifyAddr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Fatal("Failed to serve session token verifier", logging.Err(err))
+		}
+	}()
+
+	// Wait for termination signal
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+
+	slog.Info("Shutting down, waiting for in-flight requests", "graceSeconds", scalerConfig.ShutdownGrace)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(scalerConfig.ShutdownGrace)*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Error during shutdown", logging.Err(err))
+	}
+}
@@ -3,30 +3,46 @@ package cleaner
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
+	"scaler/internal/scaling"
 	"scaler/internal/vmss"
+	"scaler/pkg/appconfig"
 	"scaler/pkg/config"
+	"scaler/pkg/logging"
 	"scaler/pkg/monitoring"
 	"scaler/pkg/redis"
+	"scaler/pkg/routing"
+	"scaler/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Service struct {
-	ctx          context.Context
-	cancel       context.CancelFunc
+	runner       *scaling.Runner
 	redis        redis.Client
 	vmss         vmss.Provider
-	telemetry    *monitoring.Monitor
+	router       routing.Router
+	telemetry    monitoring.Monitor
 	scalerConfig *config.ScalerConfig
+	settings     *appconfig.Watcher
+	features     *appconfig.Features
+	owner        string
 }
 
 func NewService(
 	vmssProvider vmss.Provider,
+	router routing.Router,
 	redisClient redis.Client,
-	monitor *monitoring.Monitor,
+	monitor monitoring.Monitor,
 	scalerConfig *config.ScalerConfig,
+	leadership scaling.Leadership,
+	settings *appconfig.Watcher,
+	features *appconfig.Features,
 ) (*Service, error) {
 	// Validate mandatory parameters
 	if scalerConfig.JobInterval <= 0 {
@@ -38,75 +54,52 @@ func NewService(
 	if scalerConfig.JobDelay <= 0 {
 		return nil, fmt.Errorf("invalid job delay: %d, must be positive", scalerConfig.JobDelay)
 	}
+	if scalerConfig.LockTTL <= 0 {
+		return nil, fmt.Errorf("invalid lock TTL: %d, must be positive", scalerConfig.LockTTL)
+	}
+	if scalerConfig.WorkerPoolSize <= 0 {
+		return nil, fmt.Errorf("invalid worker pool size: %d, must be positive", scalerConfig.WorkerPoolSize)
+	}
+	if scalerConfig.InstanceTimeout <= 0 {
+		return nil, fmt.Errorf("invalid instance timeout: %d, must be positive", scalerConfig.InstanceTimeout)
+	}
 	if scalerConfig.VMRuntime <= 0 {
 		return nil, fmt.Errorf("invalid VM runtime: %d, must be positive", scalerConfig.VMRuntime)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	return &Service{
-		ctx:          ctx,
-		cancel:       cancel,
+	s := &Service{
 		redis:        redisClient,
 		vmss:         vmssProvider,
+		router:       router,
 		telemetry:    monitor,
 		scalerConfig: scalerConfig,
-	}, nil
-}
-
-func (s *Service) Start() error {
-	log.Printf("Cleaner service scheduled to start in %d seconds...", s.scalerConfig.JobDelay)
-
-	// Start the service with delay
-	go func() {
-		// Initial delay
-		time.Sleep(time.Duration(s.scalerConfig.JobDelay) * time.Second)
+		settings:     settings,
+		features:     features,
+		owner:        redis.NewOwnerID("cleaner"),
+	}
 
-		log.Printf("Starting cleaner service...")
-		s.run()
-	}()
+	runner, err := scaling.NewJobRunner("cleaner", scalerConfig, leadership, scaling.Wake(redisClient, redis.EventUsed), s.clean)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	s.runner = runner
+	return s, nil
 }
 
-func (s *Service) Stop() error {
-	log.Printf("Stopping cleaner service...")
-	s.cancel()
-	return nil
+func (s *Service) Start() error {
+	slog.Info("Cleaner service scheduled to start", "delaySeconds", s.scalerConfig.JobDelay)
+	return s.runner.Start()
 }
 
-func (s *Service) run() {
-	ticker := time.NewTicker(time.Duration(s.scalerConfig.JobInterval) * time.Second)
-	defer ticker.Stop()
-
-	// Channel to coordinate operations
-	done := make(chan bool, 1)
-	done <- true // Initial token
-
-	for {
-		select {
-		case <-s.ctx.Done():
-			return
-		case <-ticker.C:
-			// Wait for previous operation to complete
-			select {
-			case <-done:
-				// Start new operation
-				go func() {
-					if err := s.clean(); err != nil {
-						log.Printf("Error during cleaning: %v", err)
-					}
-					done <- true // Signal completion
-				}()
-			default:
-				log.Printf("Operation still running ...")
-			}
-		}
-	}
+func (s *Service) Stop(ctx context.Context) error {
+	slog.Info("Stopping cleaner service")
+	return s.runner.Stop(ctx)
 }
 
-func (s *Service) clean() error {
-	ctx, cancel := context.WithTimeout(s.ctx, time.Duration(s.scalerConfig.JobTimeout)*time.Second)
-	defer cancel()
+func (s *Service) clean(ctx context.Context) error {
+	// Use one snapshot of the live settings for the whole run
+	settings := s.settings.Current()
 
 	// Get Unavailable instances directly from the set
 	selectedInstances, err := s.redis.SMembers(ctx, redis.VMStatusUnavailableSet)
@@ -115,98 +108,224 @@ func (s *Service) clean() error {
 	}
 
 	if len(selectedInstances) == 0 {
-		log.Printf("No unavailable instances found to clean")
+		slog.DebugContext(ctx, "No unavailable instances found to clean")
 		return nil
 	}
 
-	log.Printf("Found %d unavailable instances to clean", len(selectedInstances))
+	slog.InfoContext(ctx, "Found unavailable instances to clean", "count", len(selectedInstances))
+
+	// Clean instances in parallel, uncleaned instances stay in the unavailable set
+	results := scaling.ForEach(ctx, selectedInstances, settings.WorkerPoolSize,
+		time.Duration(settings.InstanceTimeout)*time.Second,
+		func(ctx context.Context, instance string) error {
+			err := redis.WithLock(ctx, s.redis, instance, s.owner, time.Duration(settings.LockTTL)*time.Second,
+				func(ctx context.Context) error {
+					return s.cleanInstance(ctx, instance, settings)
+				})
+			if errors.Is(err, redis.ErrLockHeld) {
+				// Another worker is updating the record, retry on the next run
+				slog.InfoContext(ctx, "Instance is locked by another worker, skipping", "key", instance)
+				return scaling.ErrSkipped
+			}
+			return err
+		})
+
+	for instance, err := range results.Failed {
+		slog.ErrorContext(ctx, "Error cleaning instance", "key", instance, logging.KeyOperation, "clean", logging.Err(err))
+	}
+
+	slog.InfoContext(ctx, "Processed unavailable instances", "count", len(selectedInstances),
+		"succeeded", len(results.Succeeded), "failed", len(results.Failed), "skipped", len(results.Skipped),
+		"abandoned", len(results.Abandoned))
+	return results.Err()
+}
+
+func (s *Service) cleanInstance(ctx context.Context, instance string, settings *config.ScalerConfig) (err error) {
+	// Get current instance data
+	instanceData, err := s.redis.Get(ctx, instance)
+	if err != nil {
+		return fmt.Errorf("failed to get instance data: %w", err)
+	}
+
+	// Parse instance data
+	var record vmss.VMRedisRecord
+	if err := json.Unmarshal([]byte(instanceData), &record); err != nil {
+		return fmt.Errorf("failed to parse instance data: %w", err)
+	}
+	ctx = logging.WithRecord(ctx, &record)
 
-	// Process each unavailable instance
-	for _, instance := range selectedInstances {
-		// Get current instance data
-		instanceData, err := s.redis.Get(ctx, instance)
+	cleanupReason := ""
+
+	if record.Used {
+		cleanupReason = "marked as used"
+	} else {
+		// Check runtime for unused instances
+		updatedAt, err := time.Parse(time.RFC3339, record.UpdatedAt)
 		if err != nil {
-			log.Printf("Error getting instance data for %s: %v", instance, err)
-			continue
+			return fmt.Errorf("failed to parse UpdatedAt time: %w", err)
 		}
 
-		// Parse instance data
-		var record vmss.VMRedisRecord
-		if err := json.Unmarshal([]byte(instanceData), &record); err != nil {
-			log.Printf("Error parsing instance data for %s: %v", instance, err)
-			continue
+		runtime := time.Since(updatedAt)
+		if runtime < time.Duration(settings.VMRuntime)*time.Second {
+			slog.DebugContext(ctx, "Instance running time is below threshold, skipping",
+				"runtimeSeconds", int(runtime.Seconds()), "thresholdSeconds", settings.VMRuntime)
+			return nil
 		}
+		cleanupReason = fmt.Sprintf("runtime %v exceeded threshold %v",
+			runtime.Round(time.Second), settings.VMRuntime)
+	}
 
-		shouldCleanup := false
-		cleanupReason := ""
-
-		if record.Used {
-			shouldCleanup = true
-			cleanupReason = "marked as used"
-		} else {
-			// Check runtime for unused instances
-			updatedAt, err := time.Parse(time.RFC3339, record.UpdatedAt)
-			if err != nil {
-				log.Printf("Error parsing UpdatedAt time for %s: %v", instance, err)
-				continue
-			}
+	slog.InfoContext(ctx, "Cleaning up instance", "reason", cleanupReason)
 
-			runtime := time.Since(updatedAt)
-			if runtime >= time.Duration(s.scalerConfig.VMRuntime)*time.Second {
-				shouldCleanup = true
-				cleanupReason = fmt.Sprintf("runtime %v exceeded threshold %v",
-					runtime.Round(time.Second), s.scalerConfig.VMRuntime)
-			} else {
-				log.Printf("Instance %s running time %v is below threshold %v, skipping",
-					instance, runtime.Round(time.Second), s.scalerConfig.VMRuntime)
-				continue
-			}
-		}
+	// Cleanup ends the session trace, a recycled instance starts a new one on its next reservation
+	ctx, span := tracing.StartInstanceSpan(ctx, &record, "instance.clean",
+		trace.WithAttributes(attribute.String("cleanup.reason", cleanupReason)))
+	defer func() { tracing.Finish(span, err) }()
 
-		if !shouldCleanup {
-			continue
-		}
+	// Recycling deallocates the instance and returns it to the pool instead of deleting it
+	region := record.Region
+	if region == "" {
+		region = s.scalerConfig.GeoName
+	}
+	if s.features.Enabled(ctx, appconfig.FeatureRecycleInstances,
+		appconfig.TargetingContext{UserID: record.VMID, Groups: []string{region}}, false) {
+		return s.recycleInstance(ctx, instance, &record)
+	}
 
-		log.Printf("Cleaning up instance %s: %s", instance, cleanupReason)
+	// Create pipeline for atomic operations
+	pipe := s.redis.Pipeline()
 
-		// Create pipeline for atomic operations
-		pipe := s.redis.Pipeline()
+	// Queue removal from unavailable set
+	if err := pipe.SRem(ctx, redis.VMStatusUnavailableSet, instance); err != nil {
+		return fmt.Errorf("failed to queue set removal: %w", err)
+	}
 
-		// Queue removal from unavailable set
-		if err := pipe.SRem(ctx, redis.VMStatusUnavailableSet, instance); err != nil {
-			log.Printf("Error queueing set removal for %s: %v", instance, err)
-			continue
-		}
+	// Queue instance data deletion
+	if err := pipe.Delete(ctx, instance); err != nil {
+		return fmt.Errorf("failed to queue instance deletion: %w", err)
+	}
 
-		// Queue instance data deletion
-		if err := pipe.Delete(ctx, instance); err != nil {
-			log.Printf("Error queueing instance deletion for %s: %v", instance, err)
-			continue
-		}
+	// Execute pipeline
+	if err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to execute Redis pipeline: %w", err)
+	}
 
-		// Execute pipeline
-		if err := pipe.Exec(ctx); err != nil {
-			log.Printf("Error executing Redis pipeline for %s: %v", instance, err)
-			continue
-		}
+	// Stop routing to the instance before it goes away, the provisioner's next sync retries failures
+	instanceRoute := &vmss.VMInstance{VMID: record.VMID, InstanceID: record.InstanceID, PrivateIP: record.PrivateIP}
+	if err := s.router.DeregisterInstance(ctx, instanceRoute); err != nil {
+		slog.WarnContext(ctx, "Failed to deregister instance route", logging.Err(err))
+	}
 
-		// Delete the VM instance from VMSS
-		if err := s.vmss.DeleteInstance(ctx, record.InstanceID); err != nil {
-			log.Printf("Error deleting VM %s: %v", record.InstanceID, err)
-			continue
-		}
+	// Delete the VM instance from VMSS
+	started := time.Now()
+	deleteErr := s.vmss.DeleteInstance(ctx, record.InstanceID)
+
+	// Submit telemetry, failures included
+	metrics := vmss.VMMetrics{
+		Operation:  "clean",
+		Duration:   time.Since(started),
+		Success:    deleteErr == nil,
+		Err:        deleteErr,
+		ResourceID: record.InstanceID,
+		Region:     record.Region,
+	}
+
+	s.telemetry.TrackVMSSOperation(ctx, metrics, s.scalerConfig.GeoName)
+
+	if deleteErr != nil {
+		return fmt.Errorf("failed to delete VM %s: %w", record.InstanceID, deleteErr)
+	}
+
+	s.publish(ctx, redis.EventCleaned, instance, &record)
 
-		// Submit telemetry
+	slog.InfoContext(ctx, "Cleaned up instance", logging.KeyOperation, "clean", logging.Duration(metrics.Duration))
+	return nil
+}
+
+func (s *Service) recycleInstance(ctx context.Context, instance string, record *vmss.VMRedisRecord) error {
+	// Deallocate first so the instance is never handed out while still running the old session
+	started := time.Now()
+	if err := s.vmss.StopInstance(ctx, record.InstanceID); err != nil {
 		metrics := vmss.VMMetrics{
-			Operation:  "clean",
-			Success:    true,
+			Operation:  "recycle",
+			Duration:   time.Since(started),
+			Success:    false,
+			Err:        err,
 			ResourceID: record.InstanceID,
+			Region:     record.Region,
 		}
-
 		s.telemetry.TrackVMSSOperation(ctx, metrics, s.scalerConfig.GeoName)
 
-		log.Printf("Cleaned up instance %s (ID: %s)", instance, record.InstanceID)
+		return fmt.Errorf("failed to deallocate VM %s: %w", record.InstanceID, err)
+	}
+
+	// Reset the record to a fresh available instance
+	*record = vmss.VMRedisRecord{
+		VMID:       record.VMID,
+		InstanceID: record.InstanceID,
+		PublicIP:   record.PublicIP,
+		PrivateIP:  record.PrivateIP,
+		Status:     string(vmss.VMStatusAvailable),
+		CreatedAt:  record.CreatedAt,
+		UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
+		Region:     record.Region,
+	}
+
+	updatedData, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal updated data: %w", err)
 	}
 
+	// Create pipeline for atomic operations
+	pipe := s.redis.Pipeline()
+
+	if err := pipe.SRem(ctx, redis.VMStatusUnavailableSet, instance); err != nil {
+		return fmt.Errorf("failed to queue set removal: %w", err)
+	}
+
+	if err := pipe.Set(ctx, instance, string(updatedData)); err != nil {
+		return fmt.Errorf("failed to queue instance update: %w", err)
+	}
+
+	if err := pipe.SAdd(ctx, redis.VMStatusAvailableSet, instance); err != nil {
+		return fmt.Errorf("failed to queue status set update: %w", err)
+	}
+
+	// Execute pipeline
+	if err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to execute Redis pipeline: %w", err)
+	}
+
+	// Submit telemetry
+	metrics := vmss.VMMetrics{
+		Operation:  "recycle",
+		Duration:   time.Since(started),
+		Success:    true,
+		ResourceID: record.InstanceID,
+		Region:     record.Region,
+	}
+
+	s.telemetry.TrackVMSSOperation(ctx, metrics, s.scalerConfig.GeoName)
+
+	s.publish(ctx, redis.EventAvailable, instance, record)
+
+	slog.InfoContext(ctx, "Recycled instance back to the available pool", logging.KeyOperation, "recycle",
+		logging.Duration(metrics.Duration))
 	return nil
 }
+
+func (s *Service) publish(ctx context.Context, eventType redis.EventType, key string, record *vmss.VMRedisRecord) {
+	event := redis.Event{
+		Type:       eventType,
+		Key:        key,
+		VMID:       record.VMID,
+		InstanceID: record.InstanceID,
+		SessionID:  record.SessionID,
+		Status:     record.Status,
+		Region:     record.Region,
+	}
+
+	if err := s.redis.Publish(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "Error publishing event", "type", eventType, "key", key, logging.Err(err))
+	}
+}
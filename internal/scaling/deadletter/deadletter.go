@@ -0,0 +1,141 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"scaler/internal/vmss"
+	"scaler/pkg/logging"
+	"scaler/pkg/redis"
+)
+
+// Entry is a dead-lettered instance record together with its Redis key
+type Entry struct {
+	Key    string
+	Record vmss.VMRedisRecord
+}
+
+// List returns the dead-lettered instances ordered by key
+func List(ctx context.Context, redisClient redis.Client) ([]Entry, error) {
+	instances, err := redisClient.SMembers(ctx, redis.VMStatusDeadLetterSet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead-lettered instances: %w", err)
+	}
+
+	sort.Strings(instances)
+
+	entries := make([]Entry, 0, len(instances))
+	for _, instance := range instances {
+		instanceData, err := redisClient.Get(ctx, instance)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get instance data for %s: %w", instance, err)
+		}
+
+		var record vmss.VMRedisRecord
+		if err := json.Unmarshal([]byte(instanceData), &record); err != nil {
+			return nil, fmt.Errorf("failed to parse instance data for %s: %w", instance, err)
+		}
+
+		entries = append(entries, Entry{Key: instance, Record: record})
+	}
+
+	return entries, nil
+}
+
+// Requeue moves a dead-lettered instance back to the given status with its retry history reset.
+// Reserved instances are started again, Available instances are returned to the pool.
+func Requeue(ctx context.Context, redisClient redis.Client, owner string, lockTTL time.Duration, instance string, status vmss.VMStatus) error {
+	var targetSet string
+	var eventType redis.EventType
+	switch status {
+	case vmss.VMStatusReserved:
+		targetSet = redis.VMStatusReservedSet
+		eventType = redis.EventReserved
+	case vmss.VMStatusAvailable:
+		targetSet = redis.VMStatusAvailableSet
+		eventType = redis.EventAvailable
+	default:
+		return fmt.Errorf("invalid requeue status: %s, must be %s or %s", status, vmss.VMStatusReserved, vmss.VMStatusAvailable)
+	}
+
+	return redis.WithLock(ctx, redisClient, instance, owner, lockTTL, func(ctx context.Context) error {
+		// Get current instance data
+		instanceData, err := redisClient.Get(ctx, instance)
+		if err != nil {
+			return fmt.Errorf("failed to get instance data: %w", err)
+		}
+
+		var record vmss.VMRedisRecord
+		if err := json.Unmarshal([]byte(instanceData), &record); err != nil {
+			return fmt.Errorf("failed to parse instance data: %w", err)
+		}
+
+		if record.Status != string(vmss.VMStatusDeadLetter) {
+			return fmt.Errorf("instance %s is not dead-lettered (status: %s)", instance, record.Status)
+		}
+
+		record.Status = string(status)
+		record.Attempts = 0
+		record.LastError = ""
+		record.NextAttemptAt = ""
+		record.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+		if status == vmss.VMStatusAvailable {
+			// The session that reserved the instance is gone
+			record.SessionID = ""
+			record.ClientIP = ""
+			record.SessionToken = ""
+			record.TokenExpiry = ""
+			record.TURNUsername = ""
+			record.TURNPassword = ""
+			record.TURNExpiry = ""
+			record.TraceContext = nil
+		}
+
+		// Convert to JSON
+		updatedData, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to marshal updated data: %w", err)
+		}
+
+		// Create pipeline for atomic operations
+		pipe := redisClient.Pipeline()
+
+		if err := pipe.Set(ctx, instance, string(updatedData)); err != nil {
+			return fmt.Errorf("failed to queue instance update: %w", err)
+		}
+
+		if err := pipe.SRem(ctx, redis.VMStatusDeadLetterSet, instance); err != nil {
+			return fmt.Errorf("failed to queue set removal: %w", err)
+		}
+
+		if err := pipe.SAdd(ctx, targetSet, instance); err != nil {
+			return fmt.Errorf("failed to queue status set update: %w", err)
+		}
+
+		// Execute pipeline
+		if err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("failed to execute Redis pipeline: %w", err)
+		}
+
+		event := redis.Event{
+			Type:       eventType,
+			Key:        instance,
+			VMID:       record.VMID,
+			InstanceID: record.InstanceID,
+			SessionID:  record.SessionID,
+			Status:     record.Status,
+			Region:     record.Region,
+		}
+
+		// The record is already requeued, a missed event only delays the next run
+		if err := redisClient.Publish(ctx, event); err != nil {
+			slog.ErrorContext(ctx, "Error publishing event", "type", eventType, "key", instance, logging.Err(err))
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,42 @@
+package scaling
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type drainKey struct{}
+
+// Draining reports whether the runner is shutting down and the work should stop at its next safe point
+func Draining(ctx context.Context) bool {
+	draining, ok := ctx.Value(drainKey{}).(chan struct{})
+	if !ok {
+		return false
+	}
+
+	select {
+	case <-draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// ShouldStop reports whether the work should stop at the current safe point
+func ShouldStop(ctx context.Context) bool {
+	return ctx.Err() != nil || Draining(ctx)
+}
+
+// AbandonedError reports items a run left unprocessed when it stopped at a safe point
+type AbandonedError struct {
+	Items []string
+}
+
+func Abandoned(items ...string) error {
+	return &AbandonedError{Items: items}
+}
+
+func (e *AbandonedError) Error() string {
+	return fmt.Sprintf("abandoned %d item(s): %s", len(e.Items), strings.Join(e.Items, ", "))
+}
@@ -0,0 +1,154 @@
+package scaling
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestShouldStop(t *testing.T) {
+	draining := make(chan struct{})
+	close(draining)
+	drainCtx := context.WithValue(context.Background(), drainKey{}, draining)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		wantDraining bool
+		wantStop     bool
+	}{
+		{name: "outside a runner", ctx: context.Background()},
+		{name: "running", ctx: context.WithValue(context.Background(), drainKey{}, make(chan struct{}))},
+		{name: "draining", ctx: drainCtx, wantDraining: true, wantStop: true},
+		{name: "cancelled", ctx: cancelled, wantStop: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Draining(tt.ctx); got != tt.wantDraining {
+				t.Errorf("Draining() = %v, want %v", got, tt.wantDraining)
+			}
+			if got := ShouldStop(tt.ctx); got != tt.wantStop {
+				t.Errorf("ShouldStop() = %v, want %v", got, tt.wantStop)
+			}
+		})
+	}
+}
+
+func TestRunnerStop(t *testing.T) {
+	tests := []struct {
+		name  string
+		grace time.Duration
+		// work runs once the runner starts and is in flight when Stop is called
+		work          WorkFunc
+		wantErr       error
+		wantAbandoned []string
+	}{
+		{
+			name:  "in-progress run drains within the grace period",
+			grace: time.Second,
+			work: func(ctx context.Context) error {
+				for !ShouldStop(ctx) {
+					time.Sleep(time.Millisecond)
+				}
+				return ctx.Err()
+			},
+		},
+		{
+			name:  "drained run reports what it left",
+			grace: time.Second,
+			work: func(ctx context.Context) error {
+				for !ShouldStop(ctx) {
+					time.Sleep(time.Millisecond)
+				}
+				return Abandoned("vm-2")
+			},
+			wantAbandoned: []string{"vm-2"},
+		},
+		{
+			name:  "run is cancelled once the grace period expires",
+			grace: 20 * time.Millisecond,
+			work: func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name:  "cancelled run reports what it abandoned",
+			grace: 20 * time.Millisecond,
+			work: func(ctx context.Context) error {
+				<-ctx.Done()
+				return Abandoned("vm-1", "vm-3")
+			},
+			wantErr:       context.DeadlineExceeded,
+			wantAbandoned: []string{"vm-1", "vm-3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			running := make(chan struct{})
+			runner, err := NewRunner(RunnerConfig{
+				Name:     "test",
+				Interval: time.Hour,
+				Timeout:  time.Minute,
+				Wake:     wakeOnce,
+			}, func(ctx context.Context) error {
+				close(running)
+				return tt.work(ctx)
+			})
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+
+			if err := runner.Start(); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			select {
+			case <-running:
+			case <-time.After(time.Second):
+				t.Fatal("run did not start")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.grace)
+			defer cancel()
+			err = runner.Stop(ctx)
+
+			if tt.wantErr == nil && tt.wantAbandoned == nil && err != nil {
+				t.Fatalf("Stop() error = %v, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Stop() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Stop() error = %v, want the run drained before the deadline", err)
+			}
+
+			var abandoned *AbandonedError
+			errors.As(err, &abandoned)
+			var got []string
+			if abandoned != nil {
+				got = abandoned.Items
+			}
+			if !reflect.DeepEqual(got, tt.wantAbandoned) {
+				t.Errorf("abandoned = %v, want %v", got, tt.wantAbandoned)
+			}
+		})
+	}
+}
+
+func TestRunnerStopBeforeStart(t *testing.T) {
+	runner, err := NewRunner(RunnerConfig{Name: "test", Interval: time.Hour, Timeout: time.Minute}, noopWork)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	if err := runner.Stop(context.Background()); err != nil {
+		t.Errorf("Stop() error = %v, want nil", err)
+	}
+}
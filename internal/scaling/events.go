@@ -0,0 +1,44 @@
+package scaling
+
+import (
+	"context"
+	"log/slog"
+
+	"scaler/pkg/logging"
+	"scaler/pkg/redis"
+)
+
+// Wake returns a trigger signalled on events of the given types.
+// Signals coalesce while one is pending, and the trigger never fires if subscribing fails,
+// leaving the job ticker as the only trigger.
+func Wake(client redis.Client, types ...redis.EventType) Trigger {
+	return func(ctx context.Context) <-chan struct{} {
+		return wake(ctx, client, types)
+	}
+}
+
+func wake(ctx context.Context, client redis.Client, types []redis.EventType) <-chan struct{} {
+	wake := make(chan struct{}, 1)
+
+	sub, err := client.Subscribe(ctx, redis.SubscribeOptions{Types: types})
+	if err != nil {
+		slog.Warn("Failed to subscribe to events, falling back to ticker", "types", types, logging.Err(err))
+		return wake
+	}
+
+	go func() {
+		defer sub.Close()
+
+		for event := range sub.Events() {
+			slog.Debug("Received event", "type", event.Type, "key", event.Key)
+
+			select {
+			case wake <- struct{}{}:
+			default:
+				// Wake-up already pending
+			}
+		}
+	}()
+
+	return wake
+}
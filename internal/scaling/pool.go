@@ -0,0 +1,108 @@
+package scaling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrSkipped marks an item that was deliberately left for a later run
+var ErrSkipped = errors.New("item skipped")
+
+// ItemFunc processes a single item of a run
+type ItemFunc func(ctx context.Context, item string) error
+
+// Results aggregates the outcome of processing a batch of items
+type Results struct {
+	Succeeded []string
+	Failed    map[string]error
+	Skipped   []string
+	Abandoned []string
+}
+
+func (r *Results) String() string {
+	return fmt.Sprintf("%d succeeded, %d failed, %d skipped, %d abandoned",
+		len(r.Succeeded), len(r.Failed), len(r.Skipped), len(r.Abandoned))
+}
+
+// Err reports the items left unprocessed when the batch stopped at a safe point
+func (r *Results) Err() error {
+	if len(r.Abandoned) == 0 {
+		return nil
+	}
+	return Abandoned(r.Abandoned...)
+}
+
+// ForEach processes items with at most size concurrent workers, bounding each item by timeout.
+// Items not yet handed to a worker when the run should stop are reported as abandoned.
+func ForEach(ctx context.Context, items []string, size int, timeout time.Duration, fn ItemFunc) *Results {
+	results := &Results{
+		Failed: make(map[string]error),
+	}
+
+	if size <= 0 {
+		size = 1
+	}
+	if size > len(items) {
+		size = len(items)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan string)
+
+	for i := 0; i < size; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range queue {
+				err := process(ctx, item, timeout, fn)
+
+				mu.Lock()
+				switch {
+				case err == nil:
+					results.Succeeded = append(results.Succeeded, item)
+				case errors.Is(err, ErrSkipped):
+					results.Skipped = append(results.Skipped, item)
+				default:
+					results.Failed[item] = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i, item := range items {
+		// Safe point: only hand out items while the run is allowed to continue
+		if ShouldStop(ctx) {
+			mu.Lock()
+			results.Abandoned = append(results.Abandoned, items[i:]...)
+			mu.Unlock()
+			break
+		}
+		queue <- item
+	}
+	close(queue)
+
+	wg.Wait()
+	return results
+}
+
+func process(ctx context.Context, item string, timeout time.Duration, fn ItemFunc) (err error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// A panicking item must not take the other workers down with it
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic processing %s: %v", item, r)
+		}
+	}()
+
+	return fn(ctx, item)
+}
@@ -0,0 +1,185 @@
+package scaling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEach(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	draining := make(chan struct{})
+	close(draining)
+	drainCtx := context.WithValue(context.Background(), drainKey{}, draining)
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		items         []string
+		timeout       time.Duration
+		fn            ItemFunc
+		wantSucceeded []string
+		wantFailed    []string
+		wantSkipped   []string
+		wantAbandoned []string
+	}{
+		{
+			name:          "all succeed",
+			ctx:           context.Background(),
+			items:         []string{"a", "b", "c"},
+			fn:            func(ctx context.Context, item string) error { return nil },
+			wantSucceeded: []string{"a", "b", "c"},
+		},
+		{
+			name:  "skipped and failed are classified",
+			ctx:   context.Background(),
+			items: []string{"a", "b", "c"},
+			fn: func(ctx context.Context, item string) error {
+				switch item {
+				case "b":
+					return fmt.Errorf("instance busy: %w", ErrSkipped)
+				case "c":
+					return errors.New("boom")
+				}
+				return nil
+			},
+			wantSucceeded: []string{"a"},
+			wantFailed:    []string{"c"},
+			wantSkipped:   []string{"b"},
+		},
+		{
+			name:    "item exceeding its timeout fails",
+			ctx:     context.Background(),
+			items:   []string{"slow", "fast"},
+			timeout: 10 * time.Millisecond,
+			fn: func(ctx context.Context, item string) error {
+				if item == "fast" {
+					return nil
+				}
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			wantSucceeded: []string{"fast"},
+			wantFailed:    []string{"slow"},
+		},
+		{
+			name:  "panic fails the item only",
+			ctx:   context.Background(),
+			items: []string{"a", "b"},
+			fn: func(ctx context.Context, item string) error {
+				if item == "a" {
+					panic("boom")
+				}
+				return nil
+			},
+			wantSucceeded: []string{"b"},
+			wantFailed:    []string{"a"},
+		},
+		{
+			name:          "cancelled parent abandons the items",
+			ctx:           cancelled,
+			items:         []string{"a", "b"},
+			fn:            func(ctx context.Context, item string) error { return nil },
+			wantAbandoned: []string{"a", "b"},
+		},
+		{
+			name:          "draining runner abandons the items",
+			ctx:           drainCtx,
+			items:         []string{"a", "b"},
+			fn:            func(ctx context.Context, item string) error { return nil },
+			wantAbandoned: []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := ForEach(tt.ctx, tt.items, 2, tt.timeout, tt.fn)
+
+			var failed []string
+			for item := range results.Failed {
+				failed = append(failed, item)
+			}
+
+			for _, c := range []struct {
+				field string
+				got   []string
+				want  []string
+			}{
+				{"Succeeded", results.Succeeded, tt.wantSucceeded},
+				{"Failed", failed, tt.wantFailed},
+				{"Skipped", results.Skipped, tt.wantSkipped},
+				{"Abandoned", results.Abandoned, tt.wantAbandoned},
+			} {
+				sort.Strings(c.got)
+				if !reflect.DeepEqual(c.got, c.want) {
+					t.Errorf("%s = %v, want %v", c.field, c.got, c.want)
+				}
+			}
+
+			var abandoned *AbandonedError
+			if errors.As(results.Err(), &abandoned) != (tt.wantAbandoned != nil) {
+				t.Errorf("Err() = %v, want an abandoned error only when items were abandoned", results.Err())
+			}
+		})
+	}
+}
+
+func TestForEachTimeoutError(t *testing.T) {
+	results := ForEach(context.Background(), []string{"slow"}, 1, 10*time.Millisecond, func(ctx context.Context, item string) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err := results.Failed["slow"]; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Failed[slow] = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestForEachBoundsConcurrency(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		items int
+		want  int32
+	}{
+		{name: "bounded by size", size: 3, items: 10, want: 3},
+		{name: "bounded by items", size: 8, items: 2, want: 2},
+		{name: "invalid size runs serially", size: 0, items: 4, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := make([]string, tt.items)
+			for i := range items {
+				items[i] = fmt.Sprintf("item-%d", i)
+			}
+
+			var active, peak int32
+			results := ForEach(context.Background(), items, tt.size, 0, func(ctx context.Context, item string) error {
+				n := atomic.AddInt32(&active, 1)
+				defer atomic.AddInt32(&active, -1)
+				for {
+					current := atomic.LoadInt32(&peak)
+					if n <= current || atomic.CompareAndSwapInt32(&peak, current, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			})
+
+			if len(results.Succeeded) != tt.items {
+				t.Errorf("Succeeded = %d, want %d", len(results.Succeeded), tt.items)
+			}
+			if peak != tt.want {
+				t.Errorf("peak concurrency = %d, want %d", peak, tt.want)
+			}
+		})
+	}
+}
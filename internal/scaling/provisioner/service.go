@@ -3,35 +3,36 @@ package provisioner
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
+	"scaler/internal/scaling"
 	"scaler/internal/vmss"
 	"scaler/pkg/appconfig"
-	"scaler/pkg/appgw"
 	"scaler/pkg/config"
+	"scaler/pkg/logging"
 	"scaler/pkg/monitoring"
+	"scaler/pkg/routing"
 )
 
 type Service struct {
-	ctx             context.Context
-	cancel          context.CancelFunc
-	vmss            vmss.Provider
-	appgw           appgw.Provider
-	telemetry       *monitoring.Monitor
-	scalerConfig    *config.ScalerConfig
-	appConfig       appconfig.Provider
-	poolCapacity    int
-	warmPoolSize    int
-	warmPoolEnabled bool
+	runner       *scaling.Runner
+	vmss         vmss.Provider
+	router       routing.Router
+	telemetry    monitoring.Monitor
+	scalerConfig *config.ScalerConfig
+	settings     *appconfig.Watcher
+	features     *appconfig.Features
 }
 
 func NewService(
 	vmssProvider vmss.Provider,
-	appGWProvider appgw.Provider,
-	monitor *monitoring.Monitor,
+	router routing.Router,
+	monitor monitoring.Monitor,
 	scalerConfig *config.ScalerConfig,
-	appConfigProvider appconfig.Provider,
+	leadership scaling.Leadership,
+	settings *appconfig.Watcher,
+	features *appconfig.Features,
 ) (*Service, error) {
 	// Validate mandatory parameters
 	if scalerConfig.JobInterval <= 0 {
@@ -44,101 +45,50 @@ func NewService(
 		return nil, fmt.Errorf("invalid job delay: %d, must be positive", scalerConfig.JobDelay)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-
-	// Initialize pools settings from App Config or fall back to default scaler config
-	poolCapacity := scalerConfig.PoolCapacity
-	warmPoolSize := scalerConfig.WarmPoolSize
-	warmPoolEnabled := scalerConfig.WarmPoolEnabled
+	s := &Service{
+		vmss:         vmssProvider,
+		router:       router,
+		telemetry:    monitor,
+		scalerConfig: scalerConfig,
+		settings:     settings,
+		features:     features,
+	}
 
-	if appConfigProvider != nil {
-		if config, err := appConfigProvider.ParseConfiguration(ctx); err == nil {
-			poolCapacity = config.PoolCapacity
-			warmPoolSize = config.WarmPoolSize
-			warmPoolEnabled = config.WarmPoolEnabled
-			log.Printf("Using App Config settings - Pool Capacity: %d, Warm Pool Size: %d, Warm Pool Enabled: %t",
-				poolCapacity, warmPoolSize, warmPoolEnabled)
-		} else {
-			log.Printf("Failed to parse App Config, using default scaler config: %v", err)
-		}
+	runner, err := scaling.NewJobRunner("provisioner", scalerConfig, leadership, nil, s.provision)
+	if err != nil {
+		return nil, err
 	}
 
-	return &Service{
-		ctx:             ctx,
-		cancel:          cancel,
-		vmss:            vmssProvider,
-		appgw:           appGWProvider,
-		telemetry:       monitor,
-		scalerConfig:    scalerConfig,
-		appConfig:       appConfigProvider,
-		poolCapacity:    poolCapacity,
-		warmPoolSize:    warmPoolSize,
-		warmPoolEnabled: warmPoolEnabled,
-	}, nil
+	s.runner = runner
+	return s, nil
 }
 
 func (s *Service) Start() error {
-	log.Printf("Provisioner service scheduled to start in %d seconds...", s.scalerConfig.JobDelay)
-
-	// Start the service with delay
-	go func() {
-		// Initial delay
-		time.Sleep(time.Duration(s.scalerConfig.JobDelay) * time.Second)
-
-		log.Printf("Starting provisioner service...")
-		s.run()
-	}()
-
-	return nil
+	slog.Info("Provisioner service scheduled to start", "delaySeconds", s.scalerConfig.JobDelay)
+	return s.runner.Start()
 }
 
-func (s *Service) Stop() error {
-	log.Printf("Stopping provisioner service...")
-	s.cancel()
-	return nil
+func (s *Service) Stop(ctx context.Context) error {
+	slog.Info("Stopping provisioner service")
+	return s.runner.Stop(ctx)
 }
 
-func (s *Service) run() {
-	ticker := time.NewTicker(time.Duration(s.scalerConfig.JobInterval) * time.Second)
-	defer ticker.Stop()
-
-	// Channel to coordinate operations
-	done := make(chan bool, 1)
-	done <- true // Initial token
-
-	for {
-		select {
-		case <-s.ctx.Done():
-			return
-		case <-ticker.C:
-			// Wait for previous operation to complete
-			select {
-			case <-done:
-				// Start new operation
-				go func() {
-					if err := s.provision(); err != nil {
-						log.Printf("Error during provisioning: %v", err)
-					}
-					done <- true // Signal completion
-				}()
-			default:
-				log.Printf("Operation still running ...")
-			}
-		}
-	}
-}
-
-func (s *Service) provision() error {
-	ctx, cancel := context.WithTimeout(s.ctx, time.Duration(s.scalerConfig.JobTimeout)*time.Second)
-	defer cancel()
+func (s *Service) provision(ctx context.Context) (err error) {
+	// Use one snapshot of the live settings for the whole run
+	pool := s.settings.Current()
 
 	start := time.Now()
 	metrics := vmss.VMMetrics{
 		Operation: "provision",
 		Success:   true,
+		Region:    s.scalerConfig.GeoName,
 	}
 	defer func() {
 		metrics.Duration = time.Since(start)
+		if err != nil {
+			metrics.Success = false
+			metrics.Err = err
+		}
 		s.telemetry.TrackVMSSOperation(ctx, metrics, s.scalerConfig.GeoName)
 	}()
 
@@ -153,10 +103,8 @@ func (s *Service) provision() error {
 	}
 
 	// Create VMSS instances
-	if err = s.vmss.CreateInstances(ctx, int64(s.poolCapacity)); err != nil {
-		metrics.Success = false
-		metrics.ErrorMessage = err.Error()
-		log.Printf("Failed to provision instance(s): %v", err)
+	if err = s.vmss.CreateInstances(ctx, int64(pool.PoolCapacity)); err != nil {
+		slog.ErrorContext(ctx, "Failed to provision instances", logging.KeyOperation, "provision", logging.Err(err))
 		return err
 	}
 
@@ -166,21 +114,24 @@ func (s *Service) provision() error {
 		return fmt.Errorf("failed to list instances after scaling: %w", err)
 	}
 
-	// Manage path-based rules in Application Gateway
-	err = s.appgw.UpdatePathBasedRules(ctx, newInstances)
-	if err != nil {
-		metrics.Success = false
-		metrics.ErrorMessage = err.Error()
-		log.Printf("Failed to update path-based rules: %v", err)
-		return err
-	}
-
-	// Identify newly provisioned instances
+	// Identify newly provisioned instances and route client traffic to them
 	var provisionedInstances []string
 	for _, instance := range newInstances {
-		if !oldInstanceMap[instance.InstanceID] {
-			provisionedInstances = append(provisionedInstances, instance.InstanceID)
+		if oldInstanceMap[instance.InstanceID] {
+			continue
 		}
+		provisionedInstances = append(provisionedInstances, instance.InstanceID)
+
+		if err = s.router.RegisterInstance(ctx, instance); err != nil {
+			slog.ErrorContext(ctx, "Failed to register instance route", logging.KeyInstanceID, instance.InstanceID, logging.Err(err))
+			return err
+		}
+	}
+
+	// Revert drift of the other routes, e.g. rules edited by hand or left behind by a failed cleanup
+	if err = s.router.Sync(ctx, newInstances); err != nil {
+		slog.ErrorContext(ctx, "Failed to update instance routes", logging.Err(err))
+		return err
 	}
 
 	// Get warm instances list
@@ -197,12 +148,16 @@ func (s *Service) provision() error {
 
 	// Validate warm pool settings
 	effectiveWarmPoolSize := 0
-	if s.warmPoolEnabled && s.warmPoolSize > 0 && s.warmPoolSize <= s.poolCapacity {
-		effectiveWarmPoolSize = s.warmPoolSize - currentWarmPoolSize
-		log.Printf("Effective warm pool size: %d", effectiveWarmPoolSize)
-	} else if s.warmPoolEnabled {
-		log.Printf("Invalid warm pool configuration - size: %d, capacity: %d. Disabling warm pool.",
-			s.warmPoolSize, s.poolCapacity)
+	// The warm pool can additionally be rolled out per region with a feature flag
+	warmPoolEnabled := pool.WarmPoolEnabled && s.features.Enabled(ctx, appconfig.FeatureWarmPool,
+		appconfig.TargetingContext{UserID: s.scalerConfig.GeoName, Groups: []string{s.scalerConfig.GeoName}}, true)
+
+	if warmPoolEnabled && pool.WarmPoolSize > 0 && pool.WarmPoolSize <= pool.PoolCapacity {
+		effectiveWarmPoolSize = pool.WarmPoolSize - currentWarmPoolSize
+		slog.InfoContext(ctx, "Effective warm pool size", "size", effectiveWarmPoolSize)
+	} else if warmPoolEnabled {
+		slog.WarnContext(ctx, "Invalid warm pool configuration, disabling warm pool",
+			"size", pool.WarmPoolSize, "capacity", pool.PoolCapacity)
 	}
 
 	// Handle warm and cold instances
@@ -210,21 +165,21 @@ func (s *Service) provision() error {
 	for _, instanceID := range provisionedInstances {
 		if warmCount < effectiveWarmPoolSize {
 			// Let the VM script handle shutdown for warm pool instances
-			log.Printf("Instance %s added to warm pool", instanceID)
+			slog.InfoContext(ctx, "Instance added to warm pool", logging.KeyInstanceID, instanceID)
 			warmCount++
 		} else {
 			// Deallocate instances beyond warm pool size
 			if err := s.vmss.StopInstance(ctx, instanceID); err != nil {
-				log.Printf("Failed to deallocate instance %s: %v", instanceID, err)
+				slog.ErrorContext(ctx, "Failed to deallocate instance", logging.KeyInstanceID, instanceID, logging.Err(err))
 				continue
 			}
-			log.Printf("Instance %s deallocated (cold pool)", instanceID)
+			slog.InfoContext(ctx, "Instance deallocated to cold pool", logging.KeyInstanceID, instanceID)
 		}
 	}
 
 	if len(provisionedInstances) > 0 {
-		log.Printf("Provisioned %d instances - Warm: %d, Cold: %d",
-			len(provisionedInstances), warmCount, len(provisionedInstances)-warmCount)
+		slog.InfoContext(ctx, "Provisioned instances", logging.KeyOperation, "provision",
+			"count", len(provisionedInstances), "warm", warmCount, "cold", len(provisionedInstances)-warmCount)
 	}
 
 	return nil
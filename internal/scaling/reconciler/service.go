@@ -4,33 +4,42 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
-	"strings"
+	"log/slog"
 	"time"
 
+	"scaler/internal/scaling"
 	"scaler/internal/vmss"
+	"scaler/pkg/appconfig"
 	"scaler/pkg/config"
+	"scaler/pkg/logging"
 	"scaler/pkg/redis"
+	"scaler/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Service struct {
-	ctx          context.Context
-	cancel       context.CancelFunc
+	runner       *scaling.Runner
 	vmss         vmss.Provider
 	redis        redis.Client
 	scalerConfig *config.ScalerConfig
+	features     *appconfig.Features
 }
 
 var statusSets = []string{
 	redis.VMStatusAvailableSet,
 	redis.VMStatusReservedSet,
 	redis.VMStatusUnavailableSet,
+	redis.VMStatusDeadLetterSet,
 }
 
 func NewService(
 	vmssProvider vmss.Provider,
 	redisClient redis.Client,
 	scalerConfig *config.ScalerConfig,
+	leadership scaling.Leadership,
+	features *appconfig.Features,
 ) (*Service, error) {
 	// Validate mandatory parameters
 	if scalerConfig.JobInterval <= 0 {
@@ -43,71 +52,33 @@ func NewService(
 		return nil, fmt.Errorf("invalid job delay: %d, must be positive", scalerConfig.JobDelay)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	return &Service{
-		ctx:          ctx,
-		cancel:       cancel,
+	s := &Service{
 		vmss:         vmssProvider,
 		redis:        redisClient,
 		scalerConfig: scalerConfig,
-	}, nil
-}
-
-func (s *Service) Start() error {
-	log.Printf("Reconciler service scheduled to start in %d seconds...", s.scalerConfig.JobDelay)
-
-	// Start the service with delay
-	go func() {
-		// Initial delay
-		time.Sleep(time.Duration(s.scalerConfig.JobDelay) * time.Second)
+		features:     features,
+	}
 
-		log.Printf("Starting reconciler service...")
-		s.run()
-	}()
+	runner, err := scaling.NewJobRunner("reconciler", scalerConfig, leadership, scaling.Wake(redisClient, redis.EventCleaned), s.reconcile)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	s.runner = runner
+	return s, nil
 }
 
-func (s *Service) Stop() error {
-	log.Printf("Stopping reconciler service...")
-	s.cancel()
-	return nil
+func (s *Service) Start() error {
+	slog.Info("Reconciler service scheduled to start", "delaySeconds", s.scalerConfig.JobDelay)
+	return s.runner.Start()
 }
 
-func (s *Service) run() {
-	ticker := time.NewTicker(time.Duration(s.scalerConfig.JobInterval) * time.Second)
-	defer ticker.Stop()
-
-	// Channel to coordinate operations
-	done := make(chan bool, 1)
-	done <- true // Initial token
-
-	for {
-		select {
-		case <-s.ctx.Done():
-			return
-		case <-ticker.C:
-			// Wait for previous operation to complete
-			select {
-			case <-done:
-				// Start new operation
-				go func() {
-					if err := s.reconcile(); err != nil {
-						log.Printf("Error during reconciliation: %v", err)
-					}
-					done <- true // Signal completion
-				}()
-			default:
-				log.Printf("Operation still running ...")
-			}
-		}
-	}
+func (s *Service) Stop(ctx context.Context) error {
+	slog.Info("Stopping reconciler service")
+	return s.runner.Stop(ctx)
 }
 
-func (s *Service) reconcile() error {
-	ctx, cancel := context.WithTimeout(s.ctx, time.Duration(s.scalerConfig.JobTimeout)*time.Second)
-	defer cancel()
-
+func (s *Service) reconcile(ctx context.Context) error {
 	// Get all VMSS instances for orphan detection
 	allInstances, err := s.vmss.ListInstances(ctx, vmss.ListInstancesOptions{})
 	if err != nil {
@@ -127,47 +98,68 @@ func (s *Service) reconcile() error {
 		return fmt.Errorf("failed to get Redis records: %v", err)
 	}
 
+	// Orphan deletion can be switched off per region while investigating VMSS inconsistencies
+	deleteOrphans := s.features.Enabled(ctx, appconfig.FeatureOrphanDeletion,
+		appconfig.TargetingContext{UserID: s.scalerConfig.GeoName, Groups: []string{s.scalerConfig.GeoName}}, true)
+	skippedOrphans := 0
+
 	// Handle orphaned records using allInstancesMap
 	pipe := s.redis.Pipeline()
 	orphanedKeys := make([]string, 0)
+	orphanedRecords := make([]*vmss.VMRedisRecord, 0)
 
 	// Queue all deletions
 	for _, key := range redisRecords {
 		var vmID string
 		if _, err := fmt.Sscanf(key, "vmss:instance:%s", &vmID); err != nil {
-			log.Printf("Failed to parse VMID from Redis key %s: %v", key, err)
+			slog.WarnContext(ctx, "Failed to parse VMID from Redis key", "key", key, logging.Err(err))
 			continue
 		}
 
 		// Check if VM exists in VMSS
 		if !allInstancesMap[vmID] {
+			if !deleteOrphans {
+				skippedOrphans++
+				continue
+			}
+
 			// Queue operations for orphaned record
 			if err := pipe.Delete(ctx, key); err != nil {
-				log.Printf("Failed to queue delete for Redis record %s: %v", key, err)
+				slog.ErrorContext(ctx, "Failed to queue delete for Redis record", "key", key, logging.Err(err))
 				continue
 			}
 
 			// Remove from all possible status sets to ensure cleanup
 			for _, set := range statusSets {
 				if err := pipe.SRem(ctx, set, key); err != nil {
-					log.Printf("Failed to queue status set removal for %s from %s: %v", key, set, err)
+					slog.ErrorContext(ctx, "Failed to queue status set removal", "key", key, "set", set, logging.Err(err))
 					// Continue with other sets even if one fails
 				}
 			}
 
 			orphanedKeys = append(orphanedKeys, key)
+			orphanedRecords = append(orphanedRecords, &vmss.VMRedisRecord{
+				VMID:   vmID,
+				Region: s.scalerConfig.GeoName,
+			})
 		}
 	}
 
+	if skippedOrphans > 0 {
+		slog.InfoContext(ctx, "Orphan deletion disabled by feature flag, keeping orphaned Redis records", "count", skippedOrphans)
+	}
+
 	// Execute all deletions in single pipeline if there are any orphaned records
 	if len(orphanedKeys) > 0 {
 		if err := pipe.Exec(ctx); err != nil {
-			log.Printf("Failed to execute Redis pipeline for orphaned records: %v", err)
+			slog.ErrorContext(ctx, "Failed to execute Redis pipeline for orphaned records", logging.Err(err))
 			return fmt.Errorf("failed to remove orphaned records: %w", err)
 		}
-		log.Printf("Removed %d orphaned Redis records: %s",
-			len(orphanedKeys),
-			strings.Join(orphanedKeys, ", "))
+		slog.InfoContext(ctx, "Removed orphaned Redis records", "count", len(orphanedKeys), "keys", orphanedKeys)
+
+		for i, key := range orphanedKeys {
+			s.publish(ctx, redis.EventOrphanRemoved, key, orphanedRecords[i])
+		}
 
 		// Refetch Redis records only after successful deletion
 		redisRecords, err = s.redis.Keys(ctx, redisKeys)
@@ -195,6 +187,8 @@ func (s *Service) reconcile() error {
 
 	pipe = s.redis.Pipeline()
 	newRecords := make([]string, 0)
+	newRecordKeys := make([]string, 0)
+	newRecordData := make([]*vmss.VMRedisRecord, 0)
 
 	for _, instance := range stoppedInstances {
 		redisKey := fmt.Sprintf("vmss:instance:%s", instance.VMID)
@@ -207,6 +201,7 @@ func (s *Service) reconcile() error {
 				VMID:       instance.VMID,
 				InstanceID: instance.InstanceID,
 				PublicIP:   instance.PublicIP,
+				PrivateIP:  instance.PrivateIP,
 				// ClientIP:   instance.ClientIP,
 				// SessionID: instance.SessionID,
 				Status:    string(vmss.VMStatusAvailable),
@@ -216,42 +211,68 @@ func (s *Service) reconcile() error {
 				Warm:      isWarm,
 			}
 
+			// The instance trace starts when it joins the pool
+			_, span := tracing.StartInstanceSpan(ctx, record, "instance.register",
+				trace.WithAttributes(attribute.Bool("vm.warm", isWarm)))
+			span.End()
+
 			// Convert to JSON before storing
 			recordJSON, err := json.Marshal(record)
 			if err != nil {
-				log.Printf("Failed to marshal record for instance %s: %v", instance.VMID, err)
+				slog.ErrorContext(ctx, "Failed to marshal record", logging.KeyVMID, instance.VMID, logging.Err(err))
 				continue
 			}
 
 			// Queue record creation operations
 			if err := pipe.Set(ctx, redisKey, string(recordJSON)); err != nil {
-				log.Printf("Failed to queue Redis record for instance %s: %v", instance.VMID, err)
+				slog.ErrorContext(ctx, "Failed to queue Redis record", logging.KeyVMID, instance.VMID, logging.Err(err))
 				continue
 			}
 			if err := pipe.SAdd(ctx, redis.VMStatusAvailableSet, redisKey); err != nil {
-				log.Printf("Failed to queue status set update for instance %s: %v", instance.VMID, err)
+				slog.ErrorContext(ctx, "Failed to queue status set update", logging.KeyVMID, instance.VMID, logging.Err(err))
 				continue
 			}
 			newRecords = append(newRecords, instance.VMID)
+			newRecordKeys = append(newRecordKeys, redisKey)
+			newRecordData = append(newRecordData, record)
 
 			suffix := "cold"
 			if isWarm {
 				suffix = "warm"
 			}
-			log.Printf("Queued new %s instance record: %s", suffix, instance.InstanceID)
+			slog.InfoContext(ctx, "Queued new instance record", "pool", suffix,
+				logging.KeyInstanceID, instance.InstanceID, logging.KeyVMID, instance.VMID)
 		}
 	}
 
 	// Execute all creations in single pipeline if there are any new records
 	if len(newRecords) > 0 {
 		if err := pipe.Exec(ctx); err != nil {
-			log.Printf("Failed to execute Redis pipeline for new records: %v", err)
+			slog.ErrorContext(ctx, "Failed to execute Redis pipeline for new records", logging.Err(err))
 			return fmt.Errorf("failed to create new records: %w", err)
 		}
-		log.Printf("Created %d new Redis records: %s",
-			len(newRecords),
-			strings.Join(newRecords, ", "))
+		slog.InfoContext(ctx, "Created new Redis records", "count", len(newRecords), "vmIds", newRecords)
+
+		for i, key := range newRecordKeys {
+			s.publish(ctx, redis.EventAvailable, key, newRecordData[i])
+		}
 	}
 
 	return nil
 }
+
+func (s *Service) publish(ctx context.Context, eventType redis.EventType, key string, record *vmss.VMRedisRecord) {
+	event := redis.Event{
+		Type:       eventType,
+		Key:        key,
+		VMID:       record.VMID,
+		InstanceID: record.InstanceID,
+		SessionID:  record.SessionID,
+		Status:     record.Status,
+		Region:     record.Region,
+	}
+
+	if err := s.redis.Publish(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "Error publishing event", "type", eventType, "key", key, logging.Err(err))
+	}
+}
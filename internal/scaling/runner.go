@@ -0,0 +1,396 @@
+package scaling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"scaler/pkg/config"
+	"scaler/pkg/logging"
+	"scaler/pkg/monitoring"
+	"scaler/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OverlapPolicy decides what happens to a tick while the previous run is still in flight
+type OverlapPolicy int
+
+const (
+	// OverlapSkip drops the tick
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueue runs once more as soon as the running operation completes
+	OverlapQueue
+)
+
+// WorkFunc performs a single run of a job
+type WorkFunc func(ctx context.Context) error
+
+// abandonTimeout bounds how long Stop waits for a cancelled run to return
+const abandonTimeout = 5 * time.Second
+
+// Leadership gates runs to the elected replica
+type Leadership interface {
+	// Lead returns a context cancelled when leadership is lost, or false when not leading
+	Lead(ctx context.Context) (context.Context, context.CancelFunc, bool)
+}
+
+// Trigger subscribes to out-of-band wake-ups for the lifetime of ctx
+type Trigger func(ctx context.Context) <-chan struct{}
+
+type RunnerConfig struct {
+	Name     string
+	Delay    time.Duration
+	Jitter   time.Duration
+	Interval time.Duration
+	Timeout  time.Duration
+	Overlap  OverlapPolicy
+	// Leader restricts runs to the elected replica, nil runs on every replica
+	Leader Leadership
+	// Wake triggers runs between ticks, wake-ups always queue behind a running operation
+	Wake Trigger
+	// OnRun is called after every run
+	OnRun func(RunMetrics)
+}
+
+// RunMetrics describes a single run
+type RunMetrics struct {
+	Name     string
+	Trigger  string
+	Started  time.Time
+	Duration time.Duration
+	Err      error
+	Panicked bool
+}
+
+// RunStats aggregates runs over the lifetime of a runner
+type RunStats struct {
+	Runs         int64
+	Failures     int64
+	Panics       int64
+	Skipped      int64
+	LastDuration time.Duration
+	LastError    string
+}
+
+// Runner schedules a work function and implements Service
+type Runner struct {
+	config     RunnerConfig
+	work       WorkFunc
+	ctx        context.Context
+	cancel     context.CancelFunc
+	runCtx     context.Context
+	cancelRuns context.CancelFunc
+	draining   chan struct{}
+	drainOnce  sync.Once
+	stopped    chan struct{}
+	inFlight   sync.WaitGroup
+	mu         sync.Mutex
+	started    bool
+	standby    bool
+	abandoned  *AbandonedError
+	stats      RunStats
+}
+
+// NewJobRunner creates a runner scheduled by the scaler job settings
+func NewJobRunner(name string, scalerConfig *config.ScalerConfig, leader Leadership, wake Trigger, work WorkFunc) (*Runner, error) {
+	return NewRunner(RunnerConfig{
+		Name:     name,
+		Delay:    time.Duration(scalerConfig.JobDelay) * time.Second,
+		Jitter:   time.Duration(scalerConfig.JobJitter) * time.Second,
+		Interval: time.Duration(scalerConfig.JobInterval) * time.Second,
+		Timeout:  time.Duration(scalerConfig.JobTimeout) * time.Second,
+		Overlap:  OverlapSkip,
+		Leader:   leader,
+		Wake:     wake,
+		OnRun:    ObserveRun,
+	}, work)
+}
+
+// ObserveRun records a run in the job metrics, runners built with NewRunner set it as OnRun
+func ObserveRun(metrics RunMetrics) {
+	monitoring.ObserveJobRun(metrics.Name, metrics.Trigger, metrics.Duration, metrics.Err)
+}
+
+func NewRunner(cfg RunnerConfig, work WorkFunc) (*Runner, error) {
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("invalid %s interval: %v, must be positive", cfg.Name, cfg.Interval)
+	}
+	if cfg.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid %s timeout: %v, must be positive", cfg.Name, cfg.Timeout)
+	}
+	if cfg.Delay < 0 || cfg.Jitter < 0 {
+		return nil, fmt.Errorf("invalid %s delay or jitter: must not be negative", cfg.Name)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Runs get their own context so Stop can drain them instead of killing them
+	draining := make(chan struct{})
+	runCtx, cancelRuns := context.WithCancel(context.WithValue(context.Background(), drainKey{}, draining))
+
+	return &Runner{
+		config:     cfg,
+		work:       work,
+		ctx:        ctx,
+		cancel:     cancel,
+		runCtx:     runCtx,
+		cancelRuns: cancelRuns,
+		draining:   draining,
+		stopped:    make(chan struct{}),
+	}, nil
+}
+
+func (r *Runner) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.started {
+		return fmt.Errorf("%s runner already started", r.config.Name)
+	}
+	r.started = true
+
+	go r.loop()
+	return nil
+}
+
+// Stop stops scheduling new runs and asks the in-flight run to stop at its next safe point.
+// Once ctx is done the run is cancelled, and Stop returns the ctx error along with whatever it abandoned.
+func (r *Runner) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	started := r.started
+	r.mu.Unlock()
+
+	r.cancel()
+	r.drainOnce.Do(func() { close(r.draining) })
+	if started {
+		<-r.stopped
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		r.inFlight.Wait()
+		close(drained)
+	}()
+
+	// Set once the run had to be cancelled
+	var expired error
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		slog.Warn("Run did not drain within the grace period, cancelling it", logging.KeyJob, r.config.Name)
+		r.cancelRuns()
+		expired = ctx.Err()
+
+		select {
+		case <-drained:
+		case <-time.After(abandonTimeout):
+			return fmt.Errorf("%s run abandoned in flight after grace period: %w", r.config.Name, expired)
+		}
+	}
+	r.cancelRuns()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case expired != nil && r.abandoned != nil:
+		return fmt.Errorf("%s run cancelled after grace period: %w: %w", r.config.Name, expired, r.abandoned)
+	case expired != nil:
+		return fmt.Errorf("%s run cancelled after grace period: %w", r.config.Name, expired)
+	case r.abandoned != nil:
+		return fmt.Errorf("%s run stopped early: %w", r.config.Name, r.abandoned)
+	}
+	return nil
+}
+
+func (r *Runner) Stats() RunStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+func (r *Runner) loop() {
+	defer close(r.stopped)
+
+	// Initial delay
+	if !r.sleep(r.config.Delay + r.jitter()) {
+		return
+	}
+
+	slog.Info("Starting service", logging.KeyJob, r.config.Name)
+
+	var wake <-chan struct{}
+	if r.config.Wake != nil {
+		wake = r.config.Wake(r.ctx)
+	}
+
+	timer := time.NewTimer(r.config.Interval + r.jitter())
+	defer timer.Stop()
+
+	// Channel to coordinate operations
+	finished := make(chan struct{}, 1)
+	running := false
+	pending := false
+
+	for {
+		trigger := "tick"
+
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-timer.C:
+			timer.Reset(r.config.Interval + r.jitter())
+			if running {
+				if r.config.Overlap == OverlapQueue {
+					pending = true
+				} else {
+					r.skip()
+				}
+				continue
+			}
+		case <-wake:
+			trigger = "event"
+			if running {
+				pending = true
+				continue
+			}
+		case <-finished:
+			running = false
+			if !pending {
+				continue
+			}
+			pending = false
+			trigger = "queued"
+		}
+
+		// Start new operation
+		running = true
+		r.inFlight.Add(1)
+		go func() {
+			defer r.inFlight.Done()
+			r.execute(trigger)
+			finished <- struct{}{} // Signal completion
+		}()
+	}
+}
+
+func (r *Runner) execute(trigger string) {
+	ctx, cancel := context.WithTimeout(r.runCtx, r.config.Timeout)
+	defer cancel()
+
+	// Only the leader mutates, and its run is cancelled as soon as leadership is lost
+	if r.config.Leader != nil {
+		leaderCtx, release, leading := r.config.Leader.Lead(ctx)
+		defer release()
+
+		if !r.lead(leading) {
+			return
+		}
+		ctx = leaderCtx
+	}
+
+	metrics := RunMetrics{
+		Name:    r.config.Name,
+		Trigger: trigger,
+		Started: time.Now(),
+	}
+
+	// Every log record and telemetry event of the run carries its run ID
+	ctx = logging.WithRun(ctx, r.config.Name)
+
+	// Instance spans link back to the run that touched them
+	ctx, span := tracing.Start(ctx, r.config.Name+".run", trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("job.trigger", trigger),
+			attribute.String("job.run_id", logging.RunID(ctx)),
+		))
+
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				metrics.Panicked = true
+				metrics.Err = fmt.Errorf("panic: %v", p)
+				slog.ErrorContext(ctx, "Recovered from panic", "panic", fmt.Sprint(p), "stack", string(debug.Stack()))
+			}
+		}()
+		metrics.Err = r.work(ctx)
+	}()
+
+	metrics.Duration = time.Since(metrics.Started)
+	tracing.Finish(span, metrics.Err)
+	if metrics.Err != nil && !metrics.Panicked {
+		slog.ErrorContext(ctx, "Run failed", logging.Err(metrics.Err), logging.Duration(metrics.Duration))
+	} else if metrics.Err == nil {
+		slog.DebugContext(ctx, "Run completed", "trigger", trigger, logging.Duration(metrics.Duration))
+	}
+
+	var abandoned *AbandonedError
+	errors.As(metrics.Err, &abandoned)
+
+	r.mu.Lock()
+	r.abandoned = abandoned
+	r.stats.Runs++
+	r.stats.LastDuration = metrics.Duration
+	r.stats.LastError = ""
+	if metrics.Err != nil {
+		r.stats.Failures++
+		r.stats.LastError = metrics.Err.Error()
+	}
+	if metrics.Panicked {
+		r.stats.Panics++
+	}
+	r.mu.Unlock()
+
+	if r.config.OnRun != nil {
+		r.config.OnRun(metrics)
+	}
+}
+
+// lead logs leadership transitions and reports whether to run
+func (r *Runner) lead(leading bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if leading && r.standby {
+		slog.Info("Elected leader, resuming runs", logging.KeyJob, r.config.Name)
+	} else if !leading && !r.standby {
+		slog.Info("Standing by, runs are performed by the leader", logging.KeyJob, r.config.Name)
+	}
+
+	r.standby = !leading
+	return leading
+}
+
+func (r *Runner) skip() {
+	r.mu.Lock()
+	r.stats.Skipped++
+	r.mu.Unlock()
+
+	slog.Warn("Operation still running, skipping tick", logging.KeyJob, r.config.Name)
+}
+
+func (r *Runner) jitter() time.Duration {
+	if r.config.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(r.config.Jitter)))
+}
+
+func (r *Runner) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-r.ctx.Done():
+		return false
+	}
+}
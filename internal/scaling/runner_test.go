@@ -0,0 +1,233 @@
+package scaling
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLeader grants or refuses leadership for every run
+type fakeLeader struct {
+	leading bool
+}
+
+func (f fakeLeader) Lead(ctx context.Context) (context.Context, context.CancelFunc, bool) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	return leaderCtx, cancel, f.leading
+}
+
+// wakeOnce fires a single wake-up as soon as the runner subscribes
+func wakeOnce(ctx context.Context) <-chan struct{} {
+	wake := make(chan struct{}, 1)
+	wake <- struct{}{}
+	return wake
+}
+
+// sleepWork keeps every run busy for d, returning early when the run is cancelled
+func sleepWork(d time.Duration) WorkFunc {
+	return func(ctx context.Context) error {
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+		}
+		return nil
+	}
+}
+
+// panicFirst panics on the first run only
+func panicFirst() WorkFunc {
+	var once sync.Once
+	return func(ctx context.Context) error {
+		once.Do(func() { panic("boom") })
+		return nil
+	}
+}
+
+func noopWork(ctx context.Context) error {
+	return nil
+}
+
+// recorder collects the metrics of every completed run
+type recorder struct {
+	mu   sync.Mutex
+	runs []RunMetrics
+}
+
+func (r *recorder) record(metrics RunMetrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runs = append(r.runs, metrics)
+}
+
+func (r *recorder) snapshot() []RunMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RunMetrics(nil), r.runs...)
+}
+
+func countTrigger(runs []RunMetrics, trigger string) int {
+	count := 0
+	for _, run := range runs {
+		if run.Trigger == trigger {
+			count++
+		}
+	}
+	return count
+}
+
+func TestRunner(t *testing.T) {
+	tests := []struct {
+		name   string
+		config RunnerConfig
+		work   WorkFunc
+		// wait is how long the runner is left running before it is stopped
+		wait  time.Duration
+		check func(t *testing.T, runs []RunMetrics, stats RunStats, started time.Time)
+	}{
+		{
+			name:   "overlap skip drops ticks",
+			config: RunnerConfig{Interval: 10 * time.Millisecond, Overlap: OverlapSkip},
+			work:   sleepWork(35 * time.Millisecond),
+			wait:   100 * time.Millisecond,
+			check: func(t *testing.T, runs []RunMetrics, stats RunStats, started time.Time) {
+				if stats.Skipped == 0 {
+					t.Error("Skipped = 0, want ticks dropped while a run is in flight")
+				}
+				if n := countTrigger(runs, "queued"); n != 0 {
+					t.Errorf("queued runs = %d, want 0", n)
+				}
+			},
+		},
+		{
+			name:   "overlap queue runs once more",
+			config: RunnerConfig{Interval: 10 * time.Millisecond, Overlap: OverlapQueue},
+			work:   sleepWork(35 * time.Millisecond),
+			wait:   100 * time.Millisecond,
+			check: func(t *testing.T, runs []RunMetrics, stats RunStats, started time.Time) {
+				if stats.Skipped != 0 {
+					t.Errorf("Skipped = %d, want 0", stats.Skipped)
+				}
+				if n := countTrigger(runs, "queued"); n == 0 {
+					t.Error("queued runs = 0, want ticks queued behind the running operation")
+				}
+			},
+		},
+		{
+			name:   "leader runs",
+			config: RunnerConfig{Interval: 10 * time.Millisecond, Leader: fakeLeader{leading: true}},
+			work:   noopWork,
+			wait:   50 * time.Millisecond,
+			check: func(t *testing.T, runs []RunMetrics, stats RunStats, started time.Time) {
+				if len(runs) == 0 {
+					t.Error("runs = 0, want the leader to run")
+				}
+			},
+		},
+		{
+			name:   "follower stands by",
+			config: RunnerConfig{Interval: 10 * time.Millisecond, Leader: fakeLeader{leading: false}},
+			work: func(ctx context.Context) error {
+				t.Error("work ran without leadership")
+				return nil
+			},
+			wait: 50 * time.Millisecond,
+			check: func(t *testing.T, runs []RunMetrics, stats RunStats, started time.Time) {
+				if len(runs) != 0 || stats.Runs != 0 {
+					t.Errorf("runs = %d, stats.Runs = %d, want 0", len(runs), stats.Runs)
+				}
+			},
+		},
+		{
+			name:   "wake triggers a run between ticks",
+			config: RunnerConfig{Interval: time.Hour, Wake: wakeOnce},
+			work:   noopWork,
+			wait:   50 * time.Millisecond,
+			check: func(t *testing.T, runs []RunMetrics, stats RunStats, started time.Time) {
+				if len(runs) != 1 || runs[0].Trigger != "event" {
+					t.Errorf("runs = %+v, want a single event run", runs)
+				}
+			},
+		},
+		{
+			name:   "panic is recovered",
+			config: RunnerConfig{Interval: 10 * time.Millisecond},
+			work:   panicFirst(),
+			wait:   50 * time.Millisecond,
+			check: func(t *testing.T, runs []RunMetrics, stats RunStats, started time.Time) {
+				if len(runs) < 2 {
+					t.Fatalf("runs = %d, want the runner to keep scheduling after a panic", len(runs))
+				}
+				if !runs[0].Panicked || runs[0].Err == nil {
+					t.Errorf("first run = %+v, want a recovered panic", runs[0])
+				}
+				if stats.Panics != 1 || stats.Failures != 1 {
+					t.Errorf("Panics = %d, Failures = %d, want 1 and 1", stats.Panics, stats.Failures)
+				}
+			},
+		},
+		{
+			name:   "first run waits for the delay",
+			config: RunnerConfig{Delay: 60 * time.Millisecond, Interval: 10 * time.Millisecond},
+			work:   noopWork,
+			wait:   120 * time.Millisecond,
+			check: func(t *testing.T, runs []RunMetrics, stats RunStats, started time.Time) {
+				if len(runs) == 0 {
+					t.Fatal("runs = 0, want runs once the delay has passed")
+				}
+				if waited := runs[0].Started.Sub(started); waited < 60*time.Millisecond {
+					t.Errorf("first run started after %v, want at least the 60ms delay", waited)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rec recorder
+			cfg := tt.config
+			cfg.Name = "test"
+			cfg.Timeout = time.Second
+			cfg.OnRun = rec.record
+
+			runner, err := NewRunner(cfg, tt.work)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+
+			started := time.Now()
+			if err := runner.Start(); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			time.Sleep(tt.wait)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := runner.Stop(ctx); err != nil {
+				t.Fatalf("Stop() error = %v", err)
+			}
+
+			tt.check(t, rec.snapshot(), runner.Stats(), started)
+		})
+	}
+}
+
+func TestNewRunnerValidates(t *testing.T) {
+	tests := []struct {
+		name   string
+		config RunnerConfig
+	}{
+		{name: "zero interval", config: RunnerConfig{Timeout: time.Second}},
+		{name: "zero timeout", config: RunnerConfig{Interval: time.Second}},
+		{name: "negative delay", config: RunnerConfig{Interval: time.Second, Timeout: time.Second, Delay: -time.Second}},
+		{name: "negative jitter", config: RunnerConfig{Interval: time.Second, Timeout: time.Second, Jitter: -time.Second}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRunner(tt.config, noopWork); err == nil {
+				t.Error("NewRunner() succeeded, want an error")
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package scaling
 
+import "context"
+
 // Service represents the common interface for all scaling services
 type Service interface {
-    Start() error
-    Stop() error
-}
\ No newline at end of file
+	Start() error
+	// Stop waits for in-flight work until ctx is done, then abandons it
+	Stop(ctx context.Context) error
+}
@@ -3,31 +3,46 @@ package simulator
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
+	"scaler/internal/scaling"
 	"scaler/internal/vmss"
 	"scaler/pkg/config"
+	"scaler/pkg/logging"
 	"scaler/pkg/redis"
+	"scaler/pkg/session"
+	"scaler/pkg/tracing"
+
+	"github.com/google/uuid"
 )
 
+// releaseTimeout bounds handing instances back after the run context is done
+const releaseTimeout = 10 * time.Second
+
 type simulationStep struct {
 	recordsToUpdate int
 }
 
 type Service struct {
-	ctx          context.Context
-	cancel       context.CancelFunc
+	runner       *scaling.Runner
 	redis        redis.Client
 	currentStep  int
 	schedule     []simulationStep
 	scalerConfig *config.ScalerConfig
+	signer       *session.Signer
+	turn         *session.TURNIssuer
+	owner        string
 }
 
 func NewService(
 	redisClient redis.Client,
 	scalerConfig *config.ScalerConfig,
+	leadership scaling.Leadership,
+	signer *session.Signer,
+	turn *session.TURNIssuer,
 ) (*Service, error) {
 	// Validate mandatory parameters
 	if scalerConfig.JobInterval <= 0 {
@@ -39,11 +54,11 @@ func NewService(
 	if scalerConfig.JobDelay <= 0 {
 		return nil, fmt.Errorf("invalid job delay: %d, must be positive", scalerConfig.JobDelay)
 	}
+	if scalerConfig.LockTTL <= 0 {
+		return nil, fmt.Errorf("invalid lock TTL: %d, must be positive", scalerConfig.LockTTL)
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	return &Service{
-		ctx:         ctx,
-		cancel:      cancel,
+	s := &Service{
 		redis:       redisClient,
 		currentStep: 0,
 		schedule: []simulationStep{
@@ -55,67 +70,34 @@ func NewService(
 			{recordsToUpdate: 2},
 		},
 		scalerConfig: scalerConfig,
-	}, nil
-}
-
-func (s *Service) Start() error {
-	log.Printf("Simulator service scheduled to start in %d seconds...", s.scalerConfig.JobDelay)
-
-	// Start the service with delay
-	go func() {
-		// Initial delay
-		time.Sleep(time.Duration(s.scalerConfig.JobDelay) * time.Second)
+		signer:       signer,
+		turn:         turn,
+		owner:        redis.NewOwnerID("simulator"),
+	}
 
-		log.Printf("Starting simulator service...")
-		s.run()
-	}()
+	runner, err := scaling.NewJobRunner("simulator", scalerConfig, leadership, nil, s.simulate)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	s.runner = runner
+	return s, nil
 }
 
-func (s *Service) Stop() error {
-	log.Printf("Stopping simulator service...")
-	s.cancel()
-	return nil
+func (s *Service) Start() error {
+	slog.Info("Simulator service scheduled to start", "delaySeconds", s.scalerConfig.JobDelay)
+	return s.runner.Start()
 }
 
-func (s *Service) run() {
-	ticker := time.NewTicker(time.Duration(s.scalerConfig.JobInterval) * time.Second)
-	defer ticker.Stop()
-
-	// Channel to coordinate operations
-	done := make(chan bool, 1)
-	done <- true // Initial token
-
-	for {
-		select {
-		case <-s.ctx.Done():
-			return
-		case <-ticker.C:
-			// Wait for previous operation to complete
-			select {
-			case <-done:
-				// Start new operation
-				go func() {
-					if err := s.simulate(); err != nil {
-						log.Printf("Error during sumulation: %v", err)
-					}
-					done <- true // Signal completion
-				}()
-			default:
-				log.Printf("Operation still running ...")
-			}
-		}
-	}
+func (s *Service) Stop(ctx context.Context) error {
+	slog.Info("Stopping simulator service")
+	return s.runner.Stop(ctx)
 }
 
-func (s *Service) simulate() error {
-	ctx, cancel := context.WithTimeout(s.ctx, time.Duration(s.scalerConfig.JobTimeout)*time.Second)
-	defer cancel()
-
+func (s *Service) simulate(ctx context.Context) error {
 	// Get current step
 	step := s.schedule[s.currentStep]
-	log.Printf("Executing simulation step %d: %d records to update", s.currentStep+1, step.recordsToUpdate)
+	slog.InfoContext(ctx, "Executing simulation step", "step", s.currentStep+1, "records", step.recordsToUpdate)
 
 	// Try to get requested number of instances
 	selectedInstances, err := s.redis.SPop(ctx, redis.VMStatusAvailableSet, int64(step.recordsToUpdate))
@@ -125,67 +107,150 @@ func (s *Service) simulate() error {
 
 	// Check if we got enough instances
 	if len(selectedInstances) < step.recordsToUpdate {
-		log.Printf("Warning: Requested %d instances but only got %d from Available set",
-			step.recordsToUpdate, len(selectedInstances))
+		slog.WarnContext(ctx, "Fewer instances available than requested",
+			"requested", step.recordsToUpdate, "available", len(selectedInstances))
 	}
 
 	if len(selectedInstances) == 0 {
-		log.Printf("No available instances found, skipping this simulation step")
+		slog.InfoContext(ctx, "No available instances found, skipping this simulation step")
 		s.currentStep = (s.currentStep + 1) % len(s.schedule)
 		return nil
 	}
 
-	log.Printf("Popped %d instances from available set", len(selectedInstances))
+	slog.InfoContext(ctx, "Popped instances from available set", "count", len(selectedInstances))
 
 	// Update each popped instance
-	for _, instance := range selectedInstances {
-		// Create pipeline for atomic updates
-		pipe := s.redis.Pipeline()
-
-		// Get current instance data
-		instanceData, err := s.redis.Get(ctx, instance)
-		if err != nil {
-			log.Printf("Error getting instance data for %s: %v", instance, err)
-			continue
+	for i, instance := range selectedInstances {
+		// Safe point: hand unprocessed instances back before stopping
+		if scaling.ShouldStop(ctx) {
+			remaining := selectedInstances[i:]
+			s.release(remaining)
+			return scaling.Abandoned(remaining...)
 		}
 
-		// Update instance status
-		var record vmss.VMRedisRecord
-		if err := json.Unmarshal([]byte(instanceData), &record); err != nil {
-			log.Printf("Error parsing instance data for %s: %v", instance, err)
+		err := redis.WithLock(ctx, s.redis, instance, s.owner, time.Duration(s.scalerConfig.LockTTL)*time.Second,
+			func(ctx context.Context) error {
+				return s.reserve(ctx, instance)
+			})
+		if errors.Is(err, redis.ErrLockHeld) {
+			// Another worker is updating the record, leave it available
+			slog.InfoContext(ctx, "Instance is locked by another worker, releasing", "key", instance)
+			s.release([]string{instance})
 			continue
 		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Error reserving instance", "key", instance, logging.KeyOperation, "reserve", logging.Err(err))
+		}
+	}
+
+	s.currentStep = (s.currentStep + 1) % len(s.schedule)
+	return nil
+}
+
+func (s *Service) reserve(ctx context.Context, instance string) (err error) {
+	// Create pipeline for atomic updates
+	pipe := s.redis.Pipeline()
+
+	// Get current instance data
+	instanceData, err := s.redis.Get(ctx, instance)
+	if err != nil {
+		return fmt.Errorf("failed to get instance data: %w", err)
+	}
+
+	// Update instance status
+	var record vmss.VMRedisRecord
+	if err := json.Unmarshal([]byte(instanceData), &record); err != nil {
+		return fmt.Errorf("failed to parse instance data: %w", err)
+	}
+
+	record.Status = string(vmss.VMStatusReserved)
+	record.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
 
-		record.Status = string(vmss.VMStatusReserved)
-		record.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	// Simulated sessions have no front end to assign them an ID
+	if record.SessionID == "" {
+		record.SessionID = uuid.NewString()
+	}
+	ctx = logging.WithRecord(ctx, &record)
 
-		updatedData, err := json.Marshal(record)
+	// Issue the token the client presents when connecting to the instance
+	if s.signer != nil {
+		token, expiresAt, err := s.signer.Issue(record.SessionID, record.VMID, record.ClientIP)
 		if err != nil {
-			log.Printf("Error marshaling updated data for %s: %v", instance, err)
-			continue
+			return fmt.Errorf("failed to issue session token: %w", err)
 		}
+		record.SessionToken = token
+		record.TokenExpiry = expiresAt.Format(time.RFC3339)
+	}
 
-		// Queue updates in pipeline
-		if err := pipe.Set(ctx, instance, string(updatedData)); err != nil {
-			log.Printf("Error queueing instance update for %s: %v", instance, err)
-			continue
-		}
+	// TURN credentials expire with the session, when the cleaner recycles the instance
+	if s.turn != nil {
+		credentials := s.turn.Issue(record.SessionID, time.Now().UTC().Add(time.Duration(s.scalerConfig.VMRuntime)*time.Second))
+		record.TURNUsername = credentials.Username
+		record.TURNPassword = credentials.Password
+		record.TURNExpiry = credentials.ExpiresAt.Format(time.RFC3339)
+	}
 
-		// Add to reserved set (no need to remove from available - SPOP did that)
-		if err := pipe.SAdd(ctx, redis.VMStatusReservedSet, instance); err != nil {
-			log.Printf("Error queueing addition to reserved set for %s: %v", instance, err)
-			continue
-		}
+	// Later jobs add their spans to the session trace stored in the record
+	ctx, span := tracing.StartInstanceSpan(ctx, &record, "session.reserve")
+	defer func() { tracing.Finish(span, err) }()
 
-		// Execute pipeline
-		if err := pipe.Exec(ctx); err != nil {
-			log.Printf("Error executing Redis pipeline for %s: %v", instance, err)
-			continue
-		}
+	updatedData, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal updated data: %w", err)
+	}
 
-		log.Printf("Updated instance %s to Reserved status", instance)
+	// Queue updates in pipeline
+	if err := pipe.Set(ctx, instance, string(updatedData)); err != nil {
+		return fmt.Errorf("failed to queue instance update: %w", err)
 	}
 
-	s.currentStep = (s.currentStep + 1) % len(s.schedule)
+	// Add to reserved set (no need to remove from available - SPOP did that)
+	if err := pipe.SAdd(ctx, redis.VMStatusReservedSet, instance); err != nil {
+		return fmt.Errorf("failed to queue addition to reserved set: %w", err)
+	}
+
+	// Execute pipeline
+	if err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to execute Redis pipeline: %w", err)
+	}
+
+	s.publish(ctx, redis.EventReserved, instance, &record)
+
+	slog.InfoContext(ctx, "Updated instance to Reserved status", logging.KeyOperation, "reserve")
 	return nil
 }
+
+func (s *Service) publish(ctx context.Context, eventType redis.EventType, key string, record *vmss.VMRedisRecord) {
+	event := redis.Event{
+		Type:       eventType,
+		Key:        key,
+		VMID:       record.VMID,
+		InstanceID: record.InstanceID,
+		SessionID:  record.SessionID,
+		Status:     record.Status,
+		Region:     record.Region,
+	}
+
+	if err := s.redis.Publish(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "Error publishing event", "type", eventType, "key", key, logging.Err(err))
+	}
+}
+
+// release returns popped instances to the available set
+func (s *Service) release(instances []string) {
+	// The run context may already be cancelled at this point
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	pipe := s.redis.Pipeline()
+	if err := pipe.SAdd(ctx, redis.VMStatusAvailableSet, instances...); err != nil {
+		slog.Error("Error queueing release of available instances", "count", len(instances), logging.Err(err))
+		return
+	}
+	if err := pipe.Exec(ctx); err != nil {
+		slog.Error("Error releasing available instances", "count", len(instances), logging.Err(err))
+		return
+	}
+
+	slog.Info("Released available instances", "count", len(instances))
+}
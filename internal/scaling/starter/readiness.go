@@ -0,0 +1,211 @@
+package starter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"scaler/internal/scaling"
+	"scaler/internal/vmss"
+	"scaler/pkg/logging"
+	"scaler/pkg/redis"
+	"scaler/pkg/tracing"
+)
+
+// readinessProbeTimeout bounds a single HTTP readiness probe
+const readinessProbeTimeout = 5 * time.Second
+
+func (s *Service) checkReadiness(ctx context.Context) error {
+	// Started instances live in the unavailable set until they are cleaned
+	startedInstances, err := s.redis.SMembers(ctx, redis.VMStatusUnavailableSet)
+	if err != nil {
+		return fmt.Errorf("failed to get unavailable instances: %w", err)
+	}
+
+	// Probe instances in parallel, unprobed instances stay in the unavailable set
+	results := scaling.ForEach(ctx, startedInstances, s.settings.Current().WorkerPoolSize, s.instanceTimeout(),
+		func(ctx context.Context, instance string) error {
+			err := redis.WithLock(ctx, s.redis, instance, s.owner, s.lockTTL(), func(ctx context.Context) error {
+				return s.checkInstance(ctx, instance)
+			})
+			if errors.Is(err, redis.ErrLockHeld) {
+				// Probed again on the next run
+				return scaling.ErrSkipped
+			}
+			return err
+		})
+
+	for instance, err := range results.Failed {
+		slog.ErrorContext(ctx, "Error checking readiness", "key", instance, logging.Err(err))
+	}
+
+	return results.Err()
+}
+
+func (s *Service) checkInstance(ctx context.Context, instance string) error {
+	// Get current instance data
+	instanceData, err := s.redis.Get(ctx, instance)
+	if err != nil {
+		return fmt.Errorf("failed to get instance data: %w", err)
+	}
+
+	var record vmss.VMRedisRecord
+	if err := json.Unmarshal([]byte(instanceData), &record); err != nil {
+		return fmt.Errorf("failed to parse instance data: %w", err)
+	}
+	ctx = logging.WithRecord(ctx, &record)
+
+	// Only instances still waiting for Unreal need to be probed
+	if record.Readiness != string(vmss.VMReadinessStarting) {
+		return nil
+	}
+
+	startedAt, err := time.Parse(time.RFC3339, record.StartedAt)
+	if err != nil {
+		return fmt.Errorf("failed to parse StartedAt time: %w", err)
+	}
+
+	ready, err := s.probe(ctx, &record)
+	if err != nil {
+		slog.DebugContext(ctx, "Instance is not ready yet", logging.Err(err))
+	}
+
+	now := time.Now().UTC()
+	if !ready {
+		timeout := s.settings.Current().ReadinessTimeout
+		elapsed := now.Sub(startedAt)
+		if elapsed < time.Duration(timeout)*time.Second {
+			return nil
+		}
+
+		// The span covers the whole wait since the start
+		_, span := tracing.StartInstanceSpan(ctx, &record, "instance.ready", tracing.StartedAt(record.StartedAt))
+		tracing.Finish(span, fmt.Errorf("instance not ready after %v", elapsed.Round(time.Second)))
+
+		// Give up waiting, the cleaner will recycle the instance after its runtime
+		record.Readiness = string(vmss.VMReadinessTimedOut)
+		if err := s.saveRecord(ctx, instance, &record); err != nil {
+			return fmt.Errorf("failed to update readiness: %w", err)
+		}
+
+		metrics := vmss.VMMetrics{
+			Operation:    "ready",
+			Duration:     elapsed,
+			Success:      false,
+			ErrorMessage: fmt.Sprintf("instance not ready after %v", elapsed.Round(time.Second)),
+			Err:          context.DeadlineExceeded,
+			ResourceID:   record.InstanceID,
+			Region:       record.Region,
+		}
+
+		s.telemetry.TrackVMSSOperation(ctx, metrics, s.scalerConfig.GeoName)
+
+		s.publish(ctx, redis.EventNotReady, instance, &record)
+
+		slog.WarnContext(ctx, "Instance did not become ready in time", logging.KeyOperation, "ready",
+			logging.Duration(elapsed), "timeoutSeconds", timeout)
+		return nil
+	}
+
+	_, span := tracing.StartInstanceSpan(ctx, &record, "instance.ready", tracing.StartedAt(record.StartedAt))
+	span.End()
+
+	// UpdatedAt is left untouched so the cleaner runtime keeps counting from start
+	record.Readiness = string(vmss.VMReadinessReady)
+	record.ReadyAt = now.Format(time.RFC3339)
+	if err := s.saveRecord(ctx, instance, &record); err != nil {
+		return fmt.Errorf("failed to update readiness: %w", err)
+	}
+
+	// Submit time-to-stream telemetry
+	metrics := vmss.VMMetrics{
+		Operation:  "ready",
+		Duration:   now.Sub(startedAt),
+		Success:    true,
+		ResourceID: record.InstanceID,
+		Region:     record.Region,
+	}
+
+	s.telemetry.TrackVMSSOperation(ctx, metrics, s.scalerConfig.GeoName)
+
+	s.publish(ctx, redis.EventReady, instance, &record)
+
+	slog.InfoContext(ctx, "Instance is ready", logging.KeyOperation, "ready", logging.Duration(now.Sub(startedAt)))
+	return nil
+}
+
+// probe reports whether the VM is running and Unreal answers on the readiness endpoint
+func (s *Service) probe(ctx context.Context, record *vmss.VMRedisRecord) (bool, error) {
+	instance, err := s.vmss.GetInstance(ctx, record.InstanceID)
+	if err != nil {
+		return false, err
+	}
+
+	if instance.State != vmss.PowerStateRunning {
+		return false, fmt.Errorf("power state is %q", instance.State)
+	}
+
+	// Records created before private IPs were tracked need a lookup
+	if record.PrivateIP == "" {
+		privateIP, err := s.lookupPrivateIP(ctx, record.InstanceID)
+		if err != nil {
+			return false, err
+		}
+		record.PrivateIP = privateIP
+	}
+
+	url := fmt.Sprintf("http://%s%s",
+		net.JoinHostPort(record.PrivateIP, strconv.Itoa(s.scalerConfig.ReadinessPort)),
+		s.scalerConfig.ReadinessPath)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create readiness request: %w", err)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("readiness endpoint unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false, fmt.Errorf("readiness endpoint returned %d", resp.StatusCode)
+	}
+
+	return true, nil
+}
+
+func (s *Service) lookupPrivateIP(ctx context.Context, instanceID string) (string, error) {
+	instances, err := s.vmss.ListInstances(ctx, vmss.ListInstancesOptions{
+		VMPowerStates: []vmss.VMPowerState{
+			vmss.PowerStateRunning,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list running instances: %w", err)
+	}
+
+	for _, instance := range instances {
+		if instance.InstanceID == instanceID && instance.PrivateIP != "" {
+			return instance.PrivateIP, nil
+		}
+	}
+
+	return "", fmt.Errorf("no private IP found for instance %s", instanceID)
+}
+
+func (s *Service) saveRecord(ctx context.Context, key string, record *vmss.VMRedisRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal record: %w", err)
+	}
+
+	return s.redis.Set(ctx, key, string(data))
+}
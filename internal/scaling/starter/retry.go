@@ -0,0 +1,124 @@
+package starter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"scaler/internal/vmss"
+	"scaler/pkg/logging"
+	"scaler/pkg/redis"
+)
+
+// errNotDue marks a reservation whose next start attempt is still backing off
+var errNotDue = errors.New("start attempt not due yet")
+
+// due reports whether a previously failed reservation may be started again
+func due(record *vmss.VMRedisRecord, now time.Time) bool {
+	if record.NextAttemptAt == "" {
+		return true
+	}
+
+	nextAttemptAt, err := time.Parse(time.RFC3339, record.NextAttemptAt)
+	if err != nil {
+		// A malformed timestamp must not block the reservation forever
+		return true
+	}
+
+	return !now.Before(nextAttemptAt)
+}
+
+// backoff returns the delay before the given attempt, doubling up to the configured maximum
+func (s *Service) backoff(attempts int) time.Duration {
+	settings := s.settings.Current()
+	delay := time.Duration(settings.RetryBackoff) * time.Second
+	maxDelay := time.Duration(settings.RetryBackoffMax) * time.Second
+
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	return delay
+}
+
+// retryOrDeadLetter moves a failed start back to the reserved set with backoff,
+// or to the dead-letter set once the retries are exhausted
+func (s *Service) retryOrDeadLetter(ctx context.Context, instance string, record *vmss.VMRedisRecord, startErr error) error {
+	// The start may have failed because the context expired, record the outcome regardless
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), requeueTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	record.Attempts++
+	record.LastError = startErr.Error()
+	record.Readiness = ""
+	record.StartedAt = ""
+	record.UpdatedAt = now.Format(time.RFC3339)
+
+	targetSet := redis.VMStatusReservedSet
+	if record.Attempts > s.settings.Current().StartMaxRetries {
+		record.Status = string(vmss.VMStatusDeadLetter)
+		record.NextAttemptAt = ""
+		targetSet = redis.VMStatusDeadLetterSet
+	} else {
+		record.Status = string(vmss.VMStatusReserved)
+		record.NextAttemptAt = now.Add(s.backoff(record.Attempts)).Format(time.RFC3339)
+	}
+
+	// Convert to JSON
+	updatedData, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal updated data: %w", err)
+	}
+
+	// Create pipeline for atomic operations
+	pipe := s.redis.Pipeline()
+
+	if err := pipe.Set(ctx, instance, string(updatedData)); err != nil {
+		return fmt.Errorf("failed to queue instance update: %w", err)
+	}
+
+	if err := pipe.SRem(ctx, redis.VMStatusUnavailableSet, instance); err != nil {
+		return fmt.Errorf("failed to queue set removal: %w", err)
+	}
+
+	if err := pipe.SAdd(ctx, targetSet, instance); err != nil {
+		return fmt.Errorf("failed to queue status set update: %w", err)
+	}
+
+	// Execute pipeline
+	if err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to execute Redis pipeline: %w", err)
+	}
+
+	// Submit telemetry
+	metrics := vmss.VMMetrics{
+		Operation:    "start",
+		Success:      false,
+		ErrorMessage: record.LastError,
+		Err:          startErr,
+		ResourceID:   record.InstanceID,
+		Region:       record.Region,
+	}
+
+	s.telemetry.TrackVMSSOperation(ctx, metrics, s.scalerConfig.GeoName)
+
+	if record.Status == string(vmss.VMStatusDeadLetter) {
+		s.publish(ctx, redis.EventDeadLettered, instance, record)
+		slog.ErrorContext(ctx, "Dead-lettered instance after failed start attempts", logging.KeyOperation, "start",
+			"attempts", record.Attempts, logging.KeyError, record.LastError)
+	} else {
+		// Retries are not announced, waking the starter before the backoff has elapsed would only
+		// requeue them. The next tick picks them up.
+		slog.WarnContext(ctx, "Start attempt failed, retrying", logging.KeyOperation, "start",
+			"attempts", record.Attempts, "nextAttemptAt", record.NextAttemptAt, logging.KeyError, record.LastError)
+	}
+
+	return nil
+}
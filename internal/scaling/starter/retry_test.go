@@ -0,0 +1,246 @@
+package starter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"scaler/internal/vmss"
+	"scaler/pkg/appconfig"
+	"scaler/pkg/config"
+	"scaler/pkg/monitoring"
+	"scaler/pkg/redis"
+)
+
+// memoryRedis keeps records, status sets and published events in memory
+type memoryRedis struct {
+	redis.Client
+	records map[string]string
+	sets    map[string]map[string]bool
+	events  []redis.Event
+}
+
+func newMemoryRedis() *memoryRedis {
+	return &memoryRedis{
+		records: make(map[string]string),
+		sets:    make(map[string]map[string]bool),
+	}
+}
+
+func (m *memoryRedis) Pipeline() redis.Pipeline {
+	return &memoryPipeline{redis: m}
+}
+
+func (m *memoryRedis) Publish(ctx context.Context, event redis.Event) error {
+	m.events = append(m.events, event)
+	return nil
+}
+
+// memoryPipeline applies the commands as they are queued
+type memoryPipeline struct {
+	redis *memoryRedis
+}
+
+func (p *memoryPipeline) Set(ctx context.Context, key, value string) error {
+	p.redis.records[key] = value
+	return nil
+}
+
+func (p *memoryPipeline) SAdd(ctx context.Context, key string, members ...string) error {
+	if p.redis.sets[key] == nil {
+		p.redis.sets[key] = make(map[string]bool)
+	}
+	for _, member := range members {
+		p.redis.sets[key][member] = true
+	}
+	return nil
+}
+
+func (p *memoryPipeline) SRem(ctx context.Context, key string, members ...string) error {
+	for _, member := range members {
+		delete(p.redis.sets[key], member)
+	}
+	return nil
+}
+
+func (p *memoryPipeline) Delete(ctx context.Context, key string) error {
+	delete(p.redis.records, key)
+	return nil
+}
+
+func (p *memoryPipeline) Exec(ctx context.Context) error {
+	return nil
+}
+
+// discardMonitor drops all telemetry
+type discardMonitor struct {
+	monitoring.Monitor
+}
+
+func (discardMonitor) TrackVMSSOperation(ctx context.Context, metrics vmss.VMMetrics, geoName string) {
+}
+
+func newTestService(t *testing.T, redisClient redis.Client) *Service {
+	t.Helper()
+	settings, err := appconfig.NewWatcher(nil, "", 0, &config.ScalerConfig{
+		StartMaxRetries: 3,
+		RetryBackoff:    10,
+		RetryBackoffMax: 60,
+	})
+	if err != nil {
+		t.Fatalf("failed to create settings watcher: %v", err)
+	}
+
+	return &Service{
+		redis:        redisClient,
+		telemetry:    discardMonitor{},
+		scalerConfig: &config.ScalerConfig{},
+		settings:     settings,
+	}
+}
+
+func TestDue(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		nextAttemptAt string
+		want          bool
+	}{
+		{name: "never failed", nextAttemptAt: "", want: true},
+		{name: "backoff elapsed", nextAttemptAt: now.Add(-time.Second).Format(time.RFC3339), want: true},
+		{name: "backoff ends now", nextAttemptAt: now.Format(time.RFC3339), want: true},
+		{name: "backing off", nextAttemptAt: now.Add(time.Second).Format(time.RFC3339), want: false},
+		{name: "malformed timestamp", nextAttemptAt: "soon", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := &vmss.VMRedisRecord{NextAttemptAt: tt.nextAttemptAt}
+			if got := due(record, now); got != tt.want {
+				t.Errorf("due(%q) = %v, want %v", tt.nextAttemptAt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	s := newTestService(t, newMemoryRedis())
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 0, want: 10 * time.Second},
+		{attempts: 1, want: 10 * time.Second},
+		{attempts: 2, want: 20 * time.Second},
+		{attempts: 3, want: 40 * time.Second},
+		{attempts: 4, want: 60 * time.Second},
+		{attempts: 50, want: 60 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := s.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRetryOrDeadLetter(t *testing.T) {
+	tests := []struct {
+		name         string
+		attempts     int
+		wantStatus   vmss.VMStatus
+		wantSet      string
+		wantBackoff  time.Duration
+		wantEvents   []redis.EventType
+		wantAttempts int
+	}{
+		{
+			name:         "first failure backs off",
+			attempts:     0,
+			wantStatus:   vmss.VMStatusReserved,
+			wantSet:      redis.VMStatusReservedSet,
+			wantBackoff:  10 * time.Second,
+			wantAttempts: 1,
+		},
+		{
+			name:         "last retry backs off longer",
+			attempts:     2,
+			wantStatus:   vmss.VMStatusReserved,
+			wantSet:      redis.VMStatusReservedSet,
+			wantBackoff:  40 * time.Second,
+			wantAttempts: 3,
+		},
+		{
+			name:         "retries exhausted",
+			attempts:     3,
+			wantStatus:   vmss.VMStatusDeadLetter,
+			wantSet:      redis.VMStatusDeadLetterSet,
+			wantEvents:   []redis.EventType{redis.EventDeadLettered},
+			wantAttempts: 4,
+		},
+	}
+
+	const instance = "vmss:instance:vm-1"
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryRedis()
+			store.sets[redis.VMStatusUnavailableSet] = map[string]bool{instance: true}
+			s := newTestService(t, store)
+
+			record := &vmss.VMRedisRecord{
+				VMID:       "vm-1",
+				InstanceID: "1",
+				Status:     string(vmss.VMStatusUnavailable),
+				Readiness:  string(vmss.VMReadinessStarting),
+				Attempts:   tt.attempts,
+			}
+
+			started := time.Now().UTC()
+			if err := s.retryOrDeadLetter(context.Background(), instance, record, errors.New("quota exceeded")); err != nil {
+				t.Fatalf("retryOrDeadLetter() error = %v", err)
+			}
+
+			var stored vmss.VMRedisRecord
+			if err := json.Unmarshal([]byte(store.records[instance]), &stored); err != nil {
+				t.Fatalf("failed to parse stored record: %v", err)
+			}
+			if stored.Status != string(tt.wantStatus) || stored.Attempts != tt.wantAttempts {
+				t.Errorf("stored status = %s after %d attempts, want %s after %d", stored.Status, stored.Attempts, tt.wantStatus, tt.wantAttempts)
+			}
+			if stored.LastError != "quota exceeded" || stored.Readiness != "" {
+				t.Errorf("stored LastError = %q, Readiness = %q, want the start error and no readiness", stored.LastError, stored.Readiness)
+			}
+			if !store.sets[tt.wantSet][instance] || store.sets[redis.VMStatusUnavailableSet][instance] {
+				t.Errorf("sets = %v, want the instance moved from unavailable to %s", store.sets, tt.wantSet)
+			}
+
+			if tt.wantBackoff == 0 {
+				if stored.NextAttemptAt != "" {
+					t.Errorf("NextAttemptAt = %q, want none", stored.NextAttemptAt)
+				}
+			} else {
+				nextAttemptAt, err := time.Parse(time.RFC3339, stored.NextAttemptAt)
+				if err != nil {
+					t.Fatalf("NextAttemptAt = %q: %v", stored.NextAttemptAt, err)
+				}
+				if wait := nextAttemptAt.Sub(started.Truncate(time.Second)); wait < tt.wantBackoff || wait > tt.wantBackoff+time.Second {
+					t.Errorf("next attempt in %v, want %v", wait, tt.wantBackoff)
+				}
+			}
+
+			// A retry must not wake the starter before its backoff has elapsed
+			var events []redis.EventType
+			for _, event := range store.events {
+				events = append(events, event.Type)
+			}
+			if len(events) != len(tt.wantEvents) || (len(events) > 0 && events[0] != tt.wantEvents[0]) {
+				t.Errorf("events = %v, want %v", events, tt.wantEvents)
+			}
+		})
+	}
+}
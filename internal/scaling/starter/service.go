@@ -3,30 +3,44 @@ package starter
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"time"
 
+	"scaler/internal/scaling"
 	"scaler/internal/vmss"
+	"scaler/pkg/appconfig"
 	"scaler/pkg/config"
+	"scaler/pkg/logging"
 	"scaler/pkg/monitoring"
 	"scaler/pkg/redis"
+	"scaler/pkg/tracing"
 )
 
+// requeueTimeout bounds handing reservations back after the run context is done
+const requeueTimeout = 10 * time.Second
+
 type Service struct {
-	ctx          context.Context
-	cancel       context.CancelFunc
+	starter      *scaling.Runner
+	readiness    *scaling.Runner
 	redis        redis.Client
 	vmss         vmss.Provider
-	telemetry    *monitoring.Monitor
+	telemetry    monitoring.Monitor
 	scalerConfig *config.ScalerConfig
+	settings     *appconfig.Watcher
+	httpClient   *http.Client
+	owner        string
 }
 
 func NewService(
 	vmssProvider vmss.Provider,
 	redisClient redis.Client,
-	monitor *monitoring.Monitor,
+	monitor monitoring.Monitor,
 	scalerConfig *config.ScalerConfig,
+	leadership scaling.Leadership,
+	settings *appconfig.Watcher,
 ) (*Service, error) {
 	// Validate mandatory parameters
 	if scalerConfig.JobInterval <= 0 {
@@ -38,73 +52,88 @@ func NewService(
 	if scalerConfig.JobDelay <= 0 {
 		return nil, fmt.Errorf("invalid job delay: %d, must be positive", scalerConfig.JobDelay)
 	}
+	if scalerConfig.LockTTL <= 0 {
+		return nil, fmt.Errorf("invalid lock TTL: %d, must be positive", scalerConfig.LockTTL)
+	}
+	if scalerConfig.WorkerPoolSize <= 0 {
+		return nil, fmt.Errorf("invalid worker pool size: %d, must be positive", scalerConfig.WorkerPoolSize)
+	}
+	if scalerConfig.InstanceTimeout <= 0 {
+		return nil, fmt.Errorf("invalid instance timeout: %d, must be positive", scalerConfig.InstanceTimeout)
+	}
+	if scalerConfig.StartMaxRetries < 0 {
+		return nil, fmt.Errorf("invalid start max retries: %d, must not be negative", scalerConfig.StartMaxRetries)
+	}
+	if scalerConfig.RetryBackoff <= 0 || scalerConfig.RetryBackoffMax < scalerConfig.RetryBackoff {
+		return nil, fmt.Errorf("invalid retry backoff: %d-%d, must be positive and ordered", scalerConfig.RetryBackoff, scalerConfig.RetryBackoffMax)
+	}
+	if scalerConfig.ReadinessInterval <= 0 {
+		return nil, fmt.Errorf("invalid readiness interval: %d, must be positive", scalerConfig.ReadinessInterval)
+	}
+	if scalerConfig.ReadinessTimeout <= 0 {
+		return nil, fmt.Errorf("invalid readiness timeout: %d, must be positive", scalerConfig.ReadinessTimeout)
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	return &Service{
-		ctx:          ctx,
-		cancel:       cancel,
+	s := &Service{
 		redis:        redisClient,
 		vmss:         vmssProvider,
 		telemetry:    monitor,
 		scalerConfig: scalerConfig,
-	}, nil
-}
-
-func (s *Service) Start() error {
-	log.Printf("Starter service scheduled to start in %d seconds...", s.scalerConfig.JobDelay)
+		settings:     settings,
+		httpClient: &http.Client{
+			Timeout: readinessProbeTimeout,
+		},
+		owner: redis.NewOwnerID("starter"),
+	}
 
-	// Start the service with delay
-	go func() {
-		// Initial delay
-		time.Sleep(time.Duration(s.scalerConfig.JobDelay) * time.Second)
+	starter, err := scaling.NewJobRunner("starter", scalerConfig, leadership,
+		scaling.Wake(redisClient, redis.EventReserved), s.start)
+	if err != nil {
+		return nil, err
+	}
 
-		log.Printf("Starting starter service...")
-		s.run()
-	}()
+	// Readiness is polled on its own schedule so time-to-stream is measured precisely
+	readiness, err := scaling.NewRunner(scaling.RunnerConfig{
+		Name:     "readiness",
+		Delay:    time.Duration(scalerConfig.JobDelay) * time.Second,
+		Interval: time.Duration(scalerConfig.ReadinessInterval) * time.Second,
+		Timeout:  time.Duration(scalerConfig.JobTimeout) * time.Second,
+		Overlap:  scaling.OverlapSkip,
+		Leader:   leadership,
+		Wake:     scaling.Wake(redisClient, redis.EventStarted),
+		OnRun:    scaling.ObserveRun,
+	}, s.checkReadiness)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	s.starter = starter
+	s.readiness = readiness
+	return s, nil
 }
 
-func (s *Service) Stop() error {
-	log.Printf("Stopping starter service...")
-	s.cancel()
-	return s.redis.Close()
-}
+func (s *Service) Start() error {
+	slog.Info("Starter service scheduled to start", "delaySeconds", s.scalerConfig.JobDelay)
 
-func (s *Service) run() {
-	ticker := time.NewTicker(time.Duration(s.scalerConfig.JobInterval) * time.Second)
-	defer ticker.Stop()
-
-	// Channel to coordinate operations
-	done := make(chan bool, 1)
-	done <- true // Initial token
-
-	for {
-		select {
-		case <-s.ctx.Done():
-			return
-		case <-ticker.C:
-			// Wait for previous operation to complete
-			select {
-			case <-done:
-				// Start new operation
-				go func() {
-					if err := s.start(); err != nil {
-						log.Printf("Error during starting: %v", err)
-					}
-					done <- true // Signal completion
-				}()
-			default:
-				log.Printf("Operation still running ...")
-			}
-		}
+	if err := s.readiness.Start(); err != nil {
+		return err
 	}
+	return s.starter.Start()
 }
 
-func (s *Service) start() error {
-	ctx, cancel := context.WithTimeout(s.ctx, time.Duration(s.scalerConfig.JobTimeout)*time.Second)
-	defer cancel()
+func (s *Service) Stop(ctx context.Context) error {
+	slog.Info("Stopping starter service")
+
+	// Drain both runners concurrently within the same grace period
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.readiness.Stop(ctx)
+	}()
 
+	return errors.Join(s.starter.Stop(ctx), <-errs)
+}
+
+func (s *Service) start(ctx context.Context) error {
 	// Get all Reserved instances
 	selectedInstances, err := s.redis.SPop(ctx, redis.VMStatusReservedSet, 100) // Arbitrary large limit
 	if err != nil {
@@ -112,76 +141,174 @@ func (s *Service) start() error {
 	}
 
 	if len(selectedInstances) == 0 {
-		log.Printf("No reserved instances found to process")
+		slog.DebugContext(ctx, "No reserved instances found to process")
 		return nil
 	}
 
-	log.Printf("Found %d reserved instances to process", len(selectedInstances))
+	slog.InfoContext(ctx, "Found reserved instances to process", "count", len(selectedInstances))
 
-	// Process each instance
-	for _, instance := range selectedInstances {
-		// Get current instance data
-		instanceData, err := s.redis.Get(ctx, instance)
-		if err != nil {
-			log.Printf("Error getting instance data for %s: %v", instance, err)
-			continue
-		}
+	// Process instances in parallel, handing unprocessed reservations back before stopping
+	results := scaling.ForEach(ctx, selectedInstances, s.settings.Current().WorkerPoolSize, s.instanceTimeout(),
+		func(ctx context.Context, instance string) error {
+			err := redis.WithLock(ctx, s.redis, instance, s.owner, s.lockTTL(), func(ctx context.Context) error {
+				return s.startInstance(ctx, instance)
+			})
+			if errors.Is(err, redis.ErrLockHeld) {
+				// Another worker is updating the record, retry on the next run
+				slog.InfoContext(ctx, "Instance is locked by another worker, requeueing", "key", instance)
+				s.requeue([]string{instance})
+				return scaling.ErrSkipped
+			}
+			if errors.Is(err, errNotDue) {
+				// Still backing off after a failed start, retry on a later run
+				s.requeue([]string{instance})
+				return scaling.ErrSkipped
+			}
+			return err
+		})
 
-		// Create pipeline for atomic operations
-		pipe := s.redis.Pipeline()
+	for instance, err := range results.Failed {
+		slog.ErrorContext(ctx, "Error starting instance", "key", instance, logging.KeyOperation, "start", logging.Err(err))
+	}
+	if len(results.Abandoned) > 0 {
+		s.requeue(results.Abandoned)
+	}
 
-		// Parse and update instance data
-		var record vmss.VMRedisRecord
-		if err := json.Unmarshal([]byte(instanceData), &record); err != nil {
-			log.Printf("Error parsing instance data for %s: %v", instance, err)
-			continue
-		}
+	slog.InfoContext(ctx, "Processed reserved instances", "count", len(selectedInstances),
+		"succeeded", len(results.Succeeded), "failed", len(results.Failed), "skipped", len(results.Skipped),
+		"abandoned", len(results.Abandoned))
+	return results.Err()
+}
 
-		record.Status = string(vmss.VMStatusUnavailable)
-		record.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+func (s *Service) startInstance(ctx context.Context, instance string) (err error) {
+	// Get current instance data
+	instanceData, err := s.redis.Get(ctx, instance)
+	if err != nil {
+		return fmt.Errorf("failed to get instance data: %w", err)
+	}
 
-		// Convert to JSON
-		updatedData, err := json.Marshal(record)
-		if err != nil {
-			log.Printf("Error marshaling updated data for %s: %v", instance, err)
-			continue
-		}
+	// Parse and update instance data
+	var record vmss.VMRedisRecord
+	if err := json.Unmarshal([]byte(instanceData), &record); err != nil {
+		return fmt.Errorf("failed to parse instance data: %w", err)
+	}
+	ctx = logging.WithRecord(ctx, &record)
 
-		// Queue instance record update
-		if err := pipe.Set(ctx, instance, string(updatedData)); err != nil {
-			log.Printf("Error queueing instance update for %s: %v", instance, err)
-			continue
-		}
+	// The reservation may have been released while the record was unlocked
+	if record.Status != string(vmss.VMStatusReserved) {
+		slog.InfoContext(ctx, "Instance is no longer reserved, skipping", "status", record.Status)
+		return nil
+	}
 
-		// Add to unavailable set
-		if err := pipe.SAdd(ctx, redis.VMStatusUnavailableSet, instance); err != nil {
-			log.Printf("Error queueing status set update for %s: %v", instance, err)
-			continue
-		}
+	// Failed starts wait out their backoff before the next attempt
+	if !due(&record, time.Now().UTC()) {
+		return errNotDue
+	}
 
-		// Execute pipeline
-		if err := pipe.Exec(ctx); err != nil {
-			log.Printf("Error executing Redis pipeline for %s: %v", instance, err)
-			continue
-		}
+	// Continue the session trace started at reservation
+	ctx, span := tracing.StartInstanceSpan(ctx, &record, "instance.start")
+	defer func() { tracing.Finish(span, err) }()
 
-		// Start the VM instance
-		if err := s.vmss.StartInstance(ctx, record.InstanceID); err != nil {
-			log.Printf("Error starting VM %s: %v", record.InstanceID, err)
-			continue
-		}
+	// Create pipeline for atomic operations
+	pipe := s.redis.Pipeline()
 
-		// Submit telemetry
-		metrics := vmss.VMMetrics{
-			Operation:  "start",
-			Success:    true,
-			ResourceID: record.InstanceID,
-		}
+	now := time.Now().UTC().Format(time.RFC3339)
+	record.Status = string(vmss.VMStatusUnavailable)
+	record.Readiness = string(vmss.VMReadinessStarting)
+	record.UpdatedAt = now
+	record.StartedAt = now
+	record.ReadyAt = ""
+	record.NextAttemptAt = ""
 
-		s.telemetry.TrackVMSSOperation(ctx, metrics, s.scalerConfig.GeoName)
+	// Convert to JSON
+	updatedData, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal updated data: %w", err)
+	}
+
+	// Queue instance record update
+	if err := pipe.Set(ctx, instance, string(updatedData)); err != nil {
+		return fmt.Errorf("failed to queue instance update: %w", err)
+	}
+
+	// Add to unavailable set
+	if err := pipe.SAdd(ctx, redis.VMStatusUnavailableSet, instance); err != nil {
+		return fmt.Errorf("failed to queue status set update: %w", err)
+	}
+
+	// Execute pipeline
+	if err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to execute Redis pipeline: %w", err)
+	}
+
+	// Start the VM instance
+	started := time.Now()
+	if err := s.vmss.StartInstance(ctx, record.InstanceID); err != nil {
+		startErr := fmt.Errorf("failed to start VM %s: %w", record.InstanceID, err)
+		if retryErr := s.retryOrDeadLetter(ctx, instance, &record, startErr); retryErr != nil {
+			return errors.Join(startErr, fmt.Errorf("failed to record start failure: %w", retryErr))
+		}
+		return startErr
+	}
 
-		log.Printf("Started VM %s and updated status to Unavailable", record.InstanceID)
+	// Submit telemetry
+	metrics := vmss.VMMetrics{
+		Operation:  "start",
+		Duration:   time.Since(started),
+		Success:    true,
+		ResourceID: record.InstanceID,
+		Region:     record.Region,
 	}
 
+	s.telemetry.TrackVMSSOperation(ctx, metrics, s.scalerConfig.GeoName)
+
+	s.publish(ctx, redis.EventStarted, instance, &record)
+
+	slog.InfoContext(ctx, "Started VM and updated status to Unavailable", logging.KeyOperation, "start",
+		logging.Duration(metrics.Duration), "readiness", record.Readiness)
 	return nil
 }
+
+// lockTTL and instanceTimeout follow the live settings, they apply from the next run
+func (s *Service) lockTTL() time.Duration {
+	return time.Duration(s.settings.Current().LockTTL) * time.Second
+}
+
+func (s *Service) instanceTimeout() time.Duration {
+	return time.Duration(s.settings.Current().InstanceTimeout) * time.Second
+}
+
+func (s *Service) publish(ctx context.Context, eventType redis.EventType, key string, record *vmss.VMRedisRecord) {
+	event := redis.Event{
+		Type:       eventType,
+		Key:        key,
+		VMID:       record.VMID,
+		InstanceID: record.InstanceID,
+		SessionID:  record.SessionID,
+		Status:     record.Status,
+		Region:     record.Region,
+	}
+
+	if err := s.redis.Publish(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "Error publishing event", "type", eventType, "key", key, logging.Err(err))
+	}
+}
+
+// requeue returns popped reservations to the reserved set
+func (s *Service) requeue(instances []string) {
+	// The run context may already be cancelled at this point
+	ctx, cancel := context.WithTimeout(context.Background(), requeueTimeout)
+	defer cancel()
+
+	pipe := s.redis.Pipeline()
+	if err := pipe.SAdd(ctx, redis.VMStatusReservedSet, instances...); err != nil {
+		slog.Error("Error queueing requeue of reserved instances", "count", len(instances), logging.Err(err))
+		return
+	}
+	if err := pipe.Exec(ctx); err != nil {
+		slog.Error("Error requeueing reserved instances", "count", len(instances), logging.Err(err))
+		return
+	}
+
+	slog.Info("Requeued reserved instances", "count", len(instances))
+}
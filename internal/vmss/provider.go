@@ -3,10 +3,11 @@ package vmss
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
 
 	"scaler/pkg/config"
+	"scaler/pkg/logkey"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
@@ -78,11 +79,11 @@ func (p *AzureVMSSProvider) CreateInstances(ctx context.Context, desiredCount in
 
 	// Check if the desired count is greater than the current count
 	if currentCount >= desiredCount {
-		log.Printf("scale set already has %d or more instances", currentCount)
+		slog.InfoContext(ctx, "Scale set already has enough instances", "current", currentCount, "desired", desiredCount)
 		return nil
 	}
 
-	log.Printf("Provisioning %d new instance(s)", desiredCount-currentCount)
+	slog.InfoContext(ctx, "Provisioning new instances", "count", desiredCount-currentCount)
 
 	// Prepare update object with existing SKU details
 	update := armcompute.VirtualMachineScaleSetUpdate{
@@ -113,7 +114,7 @@ func (p *AzureVMSSProvider) StartInstance(ctx context.Context, instanceID string
 	if err != nil {
 		return fmt.Errorf("failed to start instance %s: %v", instanceID, err)
 	}
-	log.Printf("Started instance %s in scale set %s", instanceID, p.config.ScaleSetName)
+	slog.InfoContext(ctx, "Started instance", logkey.InstanceID, instanceID, "scaleSet", p.config.ScaleSetName)
 	return nil
 }
 
@@ -122,7 +123,7 @@ func (p *AzureVMSSProvider) StopInstance(ctx context.Context, instanceID string)
 	if err != nil {
 		return fmt.Errorf("failed to stop instance %s: %v", instanceID, err)
 	}
-	log.Printf("Stopped instance %s in scale set %s", instanceID, p.config.ScaleSetName)
+	slog.InfoContext(ctx, "Stopped instance", logkey.InstanceID, instanceID, "scaleSet", p.config.ScaleSetName)
 	return nil
 }
 
@@ -131,7 +132,7 @@ func (p *AzureVMSSProvider) DeleteInstance(ctx context.Context, instanceID strin
 	if err != nil {
 		return fmt.Errorf("failed to delete instance %s: %v", instanceID, err)
 	}
-	log.Printf("Deleted instance %s from scale set %s", instanceID, p.config.ScaleSetName)
+	slog.InfoContext(ctx, "Deleted instance", logkey.InstanceID, instanceID, "scaleSet", p.config.ScaleSetName)
 	return nil
 }
 
@@ -210,7 +211,7 @@ func (p *AzureVMSSProvider) ListInstances(ctx context.Context, opts ListInstance
 			// Get private IP using network interfaces client
 			privateIP, err := p.getInstancePrivateIP(ctx, instance)
 			if err != nil {
-				log.Printf("Warning: %v for instance %s", err, *instance.InstanceID)
+				slog.WarnContext(ctx, "Failed to get private IP", logkey.InstanceID, *instance.InstanceID, logkey.Err(err))
 			}
 
 			instances = append(instances, &VMInstance{
@@ -224,7 +225,7 @@ func (p *AzureVMSSProvider) ListInstances(ctx context.Context, opts ListInstance
 		}
 	}
 
-	log.Printf("Listed %d instances in scale set %s (filtered by power states: %v)", len(instances), p.config.ScaleSetName, opts.VMPowerStates)
+	slog.DebugContext(ctx, "Listed instances", "count", len(instances), "scaleSet", p.config.ScaleSetName, "powerStates", opts.VMPowerStates)
 	return instances, nil
 }
 
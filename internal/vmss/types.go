@@ -9,6 +9,16 @@ const (
 	VMStatusAvailable   VMStatus = "Available"
 	VMStatusReserved    VMStatus = "Reserved"
 	VMStatusUnavailable VMStatus = "Unavailable"
+	VMStatusDeadLetter  VMStatus = "DeadLetter"
+)
+
+// VMReadiness represents the readiness sub-state of an Unavailable VM
+type VMReadiness string
+
+const (
+	VMReadinessStarting VMReadiness = "Starting"
+	VMReadinessReady    VMReadiness = "Ready"
+	VMReadinessTimedOut VMReadiness = "TimedOut"
 )
 
 type VMProvisioningState string
@@ -44,17 +54,31 @@ type VMInstance struct {
 
 // VMRedisRecord represents a record in Redis for a VMSS instance
 type VMRedisRecord struct {
-	VMID       string `json:"vmId"`
-	InstanceID string `json:"instanceId"`
-	PublicIP   string `json:"publicIp"`
-	ClientIP   string `json:"clientIp"`
-	SessionID  string `json:"sessionId"`
-	Status     string `json:"status"`
-	CreatedAt  string `json:"createdAt"`
-	UpdatedAt  string `json:"updatedAt"`
-	Region     string `json:"region"`
-	Used       bool   `json:"used"`
-	Warm       bool   `json:"warm"`
+	VMID          string `json:"vmId"`
+	InstanceID    string `json:"instanceId"`
+	PublicIP      string `json:"publicIp"`
+	PrivateIP     string `json:"privateIp"`
+	ClientIP      string `json:"clientIp"`
+	SessionID     string `json:"sessionId"`
+	SessionToken  string `json:"sessionToken,omitempty"`
+	TokenExpiry   string `json:"tokenExpiry,omitempty"`
+	TURNUsername  string `json:"turnUsername,omitempty"`
+	TURNPassword  string `json:"turnPassword,omitempty"`
+	TURNExpiry    string `json:"turnExpiry,omitempty"`
+	Status        string `json:"status"`
+	Readiness     string `json:"readiness,omitempty"`
+	CreatedAt     string `json:"createdAt"`
+	UpdatedAt     string `json:"updatedAt"`
+	StartedAt     string `json:"startedAt,omitempty"`
+	ReadyAt       string `json:"readyAt,omitempty"`
+	Attempts      int    `json:"attempts,omitempty"`
+	LastError     string `json:"lastError,omitempty"`
+	NextAttemptAt string `json:"nextAttemptAt,omitempty"`
+	Region        string `json:"region"`
+	Used          bool   `json:"used"`
+	Warm          bool   `json:"warm"`
+	// TraceContext carries the W3C trace context of the instance lifecycle between jobs
+	TraceContext map[string]string `json:"traceContext,omitempty"`
 }
 
 // Metric types for monitoring
@@ -63,6 +87,7 @@ type VMMetrics struct {
 	Duration     time.Duration
 	Success      bool
 	ErrorMessage string
+	Err          error
 	ResourceID   string
 	Region       string
 }
@@ -0,0 +1,242 @@
+package appconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"scaler/pkg/logging"
+)
+
+// featureFlagPrefix is the key prefix App Configuration stores feature flags under
+const featureFlagPrefix = ".appconfig.featureflag/"
+
+// Feature flags gating scaler behaviours
+const (
+	FeatureWarmPool         = "WarmPool"
+	FeatureRecycleInstances = "RecycleInstances"
+	FeatureOrphanDeletion   = "OrphanDeletion"
+)
+
+// FeatureFlag is the App Configuration feature flag schema
+type FeatureFlag struct {
+	ID         string `json:"id"`
+	Enabled    bool   `json:"enabled"`
+	Conditions struct {
+		ClientFilters   []FeatureFilter `json:"client_filters"`
+		RequirementType string          `json:"requirement_type"`
+	} `json:"conditions"`
+}
+
+type FeatureFilter struct {
+	Name       string          `json:"name"`
+	Parameters json.RawMessage `json:"parameters"`
+}
+
+// TargetingContext identifies what a flag is evaluated for.
+// Regions are matched as targeting groups, the user ID keeps percentage rollouts stable.
+type TargetingContext struct {
+	UserID string
+	Groups []string
+}
+
+type percentageParameters struct {
+	Value float64 `json:"Value"`
+}
+
+type targetingParameters struct {
+	Audience struct {
+		Users  []string `json:"Users"`
+		Groups []struct {
+			Name              string  `json:"Name"`
+			RolloutPercentage float64 `json:"RolloutPercentage"`
+		} `json:"Groups"`
+		DefaultRolloutPercentage float64 `json:"DefaultRolloutPercentage"`
+		Exclusion                struct {
+			Users  []string `json:"Users"`
+			Groups []string `json:"Groups"`
+		} `json:"Exclusion"`
+	} `json:"Audience"`
+}
+
+// GetFeatureFlag reads a feature flag through the provider, honouring its labels
+func GetFeatureFlag(ctx context.Context, provider Provider, name string) (*FeatureFlag, error) {
+	value, err := provider.GetConfiguration(ctx, featureFlagPrefix+name)
+	if err != nil {
+		return nil, err
+	}
+
+	var flag FeatureFlag
+	if err := json.Unmarshal([]byte(value), &flag); err != nil {
+		return nil, fmt.Errorf("failed to parse feature flag %s: %w", name, err)
+	}
+
+	return &flag, nil
+}
+
+// IsEnabled evaluates the flag and its filters for the targeting context.
+// Unknown filters never enable a flag.
+func (f *FeatureFlag) IsEnabled(target TargetingContext) bool {
+	if !f.Enabled {
+		return false
+	}
+
+	filters := f.Conditions.ClientFilters
+	if len(filters) == 0 {
+		return true
+	}
+
+	requireAll := strings.EqualFold(f.Conditions.RequirementType, "All")
+	for _, filter := range filters {
+		enabled := f.evaluate(filter, target)
+		if requireAll && !enabled {
+			return false
+		}
+		if !requireAll && enabled {
+			return true
+		}
+	}
+
+	return requireAll
+}
+
+func (f *FeatureFlag) evaluate(filter FeatureFilter, target TargetingContext) bool {
+	switch filter.Name {
+	case "Microsoft.Percentage", "Percentage":
+		var params percentageParameters
+		if err := json.Unmarshal(filter.Parameters, &params); err != nil {
+			return false
+		}
+		return rollout(f.ID, target.UserID) < params.Value
+
+	case "Microsoft.Targeting", "Targeting":
+		var params targetingParameters
+		if err := json.Unmarshal(filter.Parameters, &params); err != nil {
+			return false
+		}
+		audience := params.Audience
+
+		for _, user := range audience.Exclusion.Users {
+			if user == target.UserID {
+				return false
+			}
+		}
+		for _, group := range audience.Exclusion.Groups {
+			if containsFold(target.Groups, group) {
+				return false
+			}
+		}
+
+		for _, user := range audience.Users {
+			if user == target.UserID {
+				return true
+			}
+		}
+		for _, group := range audience.Groups {
+			if containsFold(target.Groups, group.Name) &&
+				rollout(f.ID+"\n"+group.Name, target.UserID) < group.RolloutPercentage {
+				return true
+			}
+		}
+		return rollout(f.ID, target.UserID) < audience.DefaultRolloutPercentage
+
+	default:
+		return false
+	}
+}
+
+// rollout maps a user to a stable percentage in [0, 100) for the given seed
+func rollout(seed, userID string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(seed + "\n" + userID))
+	return float64(h.Sum32()%10000) / 100
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+type cachedFlag struct {
+	flag      *FeatureFlag
+	fetchedAt time.Time
+}
+
+// Features evaluates feature flags at runtime, caching them for the refresh interval.
+// A nil Features, a missing flag or an unreachable store yields the fallback.
+type Features struct {
+	provider Provider
+	ttl      time.Duration
+	mu       sync.Mutex
+	cache    map[string]cachedFlag
+}
+
+func NewFeatures(provider Provider, ttl time.Duration) *Features {
+	return &Features{
+		provider: provider,
+		ttl:      ttl,
+		cache:    make(map[string]cachedFlag),
+	}
+}
+
+func (f *Features) Enabled(ctx context.Context, name string, target TargetingContext, fallback bool) bool {
+	if f == nil {
+		return fallback
+	}
+
+	flag, err := f.flag(ctx, name)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			slog.WarnContext(ctx, "Failed to get feature flag, using default", "flag", name, "default", fallback, logging.Err(err))
+		}
+		return fallback
+	}
+
+	return flag.IsEnabled(target)
+}
+
+func (f *Features) flag(ctx context.Context, name string) (*FeatureFlag, error) {
+	f.mu.Lock()
+	cached, ok := f.cache[name]
+	f.mu.Unlock()
+
+	if ok && time.Since(cached.fetchedAt) < f.ttl {
+		if cached.flag == nil {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, featureFlagPrefix+name)
+		}
+		return cached.flag, nil
+	}
+
+	flag, err := GetFeatureFlag(ctx, f.provider, name)
+	if errors.Is(err, ErrNotFound) {
+		// Remember missing flags too so they are not fetched on every evaluation
+		f.mu.Lock()
+		f.cache[name] = cachedFlag{fetchedAt: time.Now()}
+		f.mu.Unlock()
+		return nil, err
+	}
+	if err != nil {
+		// Keep serving the last known flag while the store is unreachable
+		if ok && cached.flag != nil {
+			slog.WarnContext(ctx, "Failed to refresh feature flag, using cached value", "flag", name, logging.Err(err))
+			return cached.flag, nil
+		}
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.cache[name] = cachedFlag{flag: flag, fetchedAt: time.Now()}
+	f.mu.Unlock()
+
+	return flag, nil
+}
@@ -0,0 +1,132 @@
+package appconfig
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testFlags = `
+.appconfig.featureflag/WarmPool:
+  id: WarmPool
+  enabled: true
+.appconfig.featureflag/RecycleInstances:
+  id: RecycleInstances
+  enabled: false
+.appconfig.featureflag/OrphanDeletion:
+  id: OrphanDeletion
+  enabled: true
+  conditions:
+    client_filters:
+      - name: Microsoft.Targeting
+        parameters:
+          Audience:
+            Groups:
+              - Name: EUR
+                RolloutPercentage: 100
+            DefaultRolloutPercentage: 0
+`
+
+// writeConfig writes the file and moves its modification time forward so the provider reloads it
+func writeConfig(t *testing.T, path, data string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("failed to write configuration file: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("failed to set modification time: %v", err)
+	}
+}
+
+func newTestFileProvider(t *testing.T, data string) (*FileProvider, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "appconfig.yaml")
+	writeConfig(t, path, data, time.Now())
+
+	provider, err := NewFileProvider(path)
+	if err != nil {
+		t.Fatalf("failed to create file provider: %v", err)
+	}
+	return provider, path
+}
+
+// flakyProvider fails every lookup while the store is unreachable
+type flakyProvider struct {
+	*FileProvider
+	unreachable bool
+}
+
+func (p *flakyProvider) GetConfiguration(ctx context.Context, key string) (string, error) {
+	if p.unreachable {
+		return "", errors.New("store unreachable")
+	}
+	return p.FileProvider.GetConfiguration(ctx, key)
+}
+
+func TestFeaturesEnabled(t *testing.T) {
+	provider, _ := newTestFileProvider(t, testFlags)
+	features := NewFeatures(provider, time.Minute)
+
+	tests := []struct {
+		name     string
+		features *Features
+		flag     string
+		region   string
+		fallback bool
+		want     bool
+	}{
+		{name: "missing flag uses default on", features: features, flag: "Unknown", fallback: true, want: true},
+		{name: "missing flag uses default off", features: features, flag: "Unknown", fallback: false, want: false},
+		{name: "enabled", features: features, flag: FeatureWarmPool, fallback: false, want: true},
+		{name: "disabled", features: features, flag: FeatureRecycleInstances, fallback: true, want: false},
+		{name: "targeted region", features: features, flag: FeatureOrphanDeletion, region: "EUR", want: true},
+		{name: "other region", features: features, flag: FeatureOrphanDeletion, region: "USA", fallback: true, want: false},
+		{name: "without App Config", flag: FeatureWarmPool, fallback: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := TargetingContext{UserID: tt.region, Groups: []string{tt.region}}
+			if got := tt.features.Enabled(context.Background(), tt.flag, target, tt.fallback); got != tt.want {
+				t.Errorf("Enabled(%s) = %v, want %v", tt.flag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFeaturesKeepLastKnown(t *testing.T) {
+	fileProvider, path := newTestFileProvider(t, testFlags)
+	provider := &flakyProvider{FileProvider: fileProvider}
+
+	// Refetch on every evaluation
+	features := NewFeatures(provider, 0)
+	ctx := context.Background()
+
+	if !features.Enabled(ctx, FeatureWarmPool, TargetingContext{}, false) {
+		t.Fatal("Enabled() = false before the store failed, want true")
+	}
+
+	provider.unreachable = true
+	if !features.Enabled(ctx, FeatureWarmPool, TargetingContext{}, false) {
+		t.Error("Enabled() = false while the store is unreachable, want the last known value")
+	}
+	if !features.Enabled(ctx, FeatureRecycleInstances, TargetingContext{}, true) {
+		t.Error("Enabled() of a flag never loaded = false, want the default")
+	}
+
+	// A broken flag definition keeps the last known value as well
+	provider.unreachable = false
+	writeConfig(t, path, ".appconfig.featureflag/WarmPool: not-json\n", time.Now().Add(time.Minute))
+	if !features.Enabled(ctx, FeatureWarmPool, TargetingContext{}, false) {
+		t.Error("Enabled() = false after the flag became invalid, want the last known value")
+	}
+
+	// A valid change is picked up once the store recovers
+	writeConfig(t, path, ".appconfig.featureflag/WarmPool:\n  id: WarmPool\n  enabled: false\n", time.Now().Add(2*time.Minute))
+	if features.Enabled(ctx, FeatureWarmPool, TargetingContext{}, true) {
+		t.Error("Enabled() = true after the flag was disabled, want false")
+	}
+}
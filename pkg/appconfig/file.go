@@ -0,0 +1,117 @@
+package appconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"scaler/pkg/logging"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileProvider serves configuration from a local JSON or YAML file of key/value pairs,
+// reloading it whenever the file changes. Nested values such as feature flags are
+// served as JSON, e.g.
+//
+//	SCALER_POOL_CAPACITY: 2
+//	.appconfig.featureflag/WarmPool:
+//	  id: WarmPool
+//	  enabled: true
+type FileProvider struct {
+	path    string
+	mu      sync.Mutex
+	modTime time.Time
+	values  map[string]string
+}
+
+func NewFileProvider(path string) (*FileProvider, error) {
+	// Validate mandatory parameters
+	if path == "" {
+		return nil, fmt.Errorf("configuration file path is required")
+	}
+
+	p := &FileProvider{
+		path: path,
+	}
+
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *FileProvider) GetConfiguration(ctx context.Context, key string) (string, error) {
+	// Pick up edits made since the last read, keeping the previous values if the file is broken
+	if err := p.reload(); err != nil {
+		slog.WarnContext(ctx, "Failed to reload configuration file, using previous values", "path", p.path, logging.Err(err))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	value, ok := p.values[key]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return value, nil
+}
+
+func (p *FileProvider) reload() error {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat configuration file: %w", err)
+	}
+
+	p.mu.Lock()
+	unchanged := p.values != nil && info.ModTime().Equal(p.modTime)
+	p.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration file: %w", err)
+	}
+
+	var raw map[string]any
+	if strings.EqualFold(filepath.Ext(p.path), ".json") {
+		err = json.Unmarshal(data, &raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse configuration file: %w", err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch v := value.(type) {
+		case string:
+			values[key] = v
+		case map[string]any, []any:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("failed to encode value of %s: %w", key, err)
+			}
+			values[key] = string(encoded)
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+
+	p.mu.Lock()
+	p.values = values
+	p.modTime = info.ModTime()
+	p.mu.Unlock()
+
+	slog.Info("Loaded configuration file", "path", p.path, "keys", len(values))
+	return nil
+}
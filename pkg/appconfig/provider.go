@@ -2,41 +2,51 @@ package appconfig
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"scaler/pkg/config"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/data/azappconfig"
 )
 
-type StaticTokenCredential struct {
-	Token azcore.AccessToken
-}
-
-type ScalerPoolConfig struct {
-	PoolCapacity    int
-	WarmPoolSize    int
-	WarmPoolEnabled bool
-}
+// ErrNotFound reports a key that is not set in the store under any of the labels
+var ErrNotFound = errors.New("configuration key not found")
 
 // Provider defines operations for managing Azure App Configuration
 type Provider interface {
 	GetConfiguration(ctx context.Context, key string) (string, error)
-	ParseConfiguration(ctx context.Context) (*ScalerPoolConfig, error)
 }
 
 type AzureAppConfigProvider struct {
 	client *azappconfig.Client
+	labels []string
 }
 
-func (s *StaticTokenCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
-	return s.Token, nil
+// NewProvider creates the configuration provider selected by config
+func NewProvider(cfg *config.AppConfigConfig) (Provider, error) {
+	switch cfg.Provider {
+	case "azure":
+		return NewAzureAppConfigProvider(cfg)
+	case "file":
+		return NewFileProvider(cfg.FilePath)
+	default:
+		return nil, fmt.Errorf("unsupported configuration provider: %s", cfg.Provider)
+	}
 }
 
 func NewAzureAppConfigProvider(cfg *config.AppConfigConfig) (*AzureAppConfigProvider, error) {
+	// Validate mandatory parameters
+	if cfg.StoreName == "" {
+		return nil, fmt.Errorf("app configuration store name is required")
+	}
+
 	// Use ManagedIdentityCredential specifically for ACI
 	cred, err := azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{
 		ID: nil, // System-assigned identity
@@ -45,77 +55,56 @@ func NewAzureAppConfigProvider(cfg *config.AppConfigConfig) (*AzureAppConfigProv
 		return nil, fmt.Errorf("failed to create managed identity credential: %v", err)
 	}
 
-	// One-time token acquisition
+	// Fail fast if the identity cannot get a token, the client refreshes it before expiry afterwards
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
 	defer cancel()
 
 	token, err := cred.GetToken(ctx, policy.TokenRequestOptions{
-		Scopes: []string{"https://azconfig.io"},
+		Scopes: []string{"https://azconfig.io/.default"},
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to acquire token: %v", err)
 	}
-	fmt.Printf("Successfully acquired App Config token (expires: %v)\n", token.ExpiresOn)
-
-	staticCred := &StaticTokenCredential{Token: token}
+	slog.Info("Successfully acquired App Config token", "expiresOn", token.ExpiresOn)
 
 	// Construct endpoint URL
 	endpoint := fmt.Sprintf("https://%s.azconfig.io", cfg.StoreName)
 
 	// Create App Configuration client
-	client, err := azappconfig.NewClient(endpoint, staticCred, nil)
+	client, err := azappconfig.NewClient(endpoint, cred, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create app configuration client: %v", err)
 	}
 
 	return &AzureAppConfigProvider{
 		client: client,
+		labels: cfg.Labels,
 	}, nil
 }
 
+// GetConfiguration returns the value of a key, preferring the most specific label.
+// Labels are configured from least to most specific (e.g. environment, then region),
+// and the unlabelled value is used when none of them is set.
 func (p *AzureAppConfigProvider) GetConfiguration(ctx context.Context, key string) (string, error) {
-	response, err := p.client.GetSetting(ctx, key, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to get configuration for key %s: %v", key, err)
-	}
-
-	if response.Value == nil {
-		return "", fmt.Errorf("configuration value not found for key %s", key)
-	}
-
-	return *response.Value, nil
-}
-
-func (p *AzureAppConfigProvider) ParseConfiguration(ctx context.Context) (*ScalerPoolConfig, error) {
-	config := &ScalerPoolConfig{}
-	var err error
-
-	// Get pool capacity
-	poolCapStr, err := p.GetConfiguration(ctx, "SCALER_POOL_CAPACITY")
-	if err != nil {
-		return nil, fmt.Errorf("failed to get pool capacity: %w", err)
-	}
-	if _, err := fmt.Sscanf(poolCapStr, "%d", &config.PoolCapacity); err != nil {
-		return nil, fmt.Errorf("invalid pool capacity value: %s", poolCapStr)
-	}
-
-	// Get warm pool size
-	warmPoolStr, err := p.GetConfiguration(ctx, "SCALER_WARMPOOL_SIZE")
-	if err != nil {
-		return nil, fmt.Errorf("failed to get warm pool size: %w", err)
-	}
-	if _, err := fmt.Sscanf(warmPoolStr, "%d", &config.WarmPoolSize); err != nil {
-		return nil, fmt.Errorf("invalid warm pool size value: %s", warmPoolStr)
-	}
-
-	// Get warm pool enabled flag
-	enabledStr, err := p.GetConfiguration(ctx, "SCALER_WARMPOOL_ENABLED")
-	if err != nil {
-		return nil, fmt.Errorf("failed to get warm pool enabled flag: %w", err)
-	}
-	if _, err := fmt.Sscanf(enabledStr, "%t", &config.WarmPoolEnabled); err != nil {
-		return nil, fmt.Errorf("invalid warm pool enabled value: %s", enabledStr)
+	for i := len(p.labels); i >= 0; i-- {
+		options := &azappconfig.GetSettingOptions{}
+		if i > 0 {
+			options.Label = to.Ptr(p.labels[i-1])
+		}
+
+		response, err := p.client.GetSetting(ctx, key, options)
+		if err != nil {
+			var respErr *azcore.ResponseError
+			if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+				continue
+			}
+			return "", fmt.Errorf("failed to get configuration for key %s: %v", key, err)
+		}
+
+		if response.Value != nil {
+			return *response.Value, nil
+		}
 	}
 
-	return config, nil
+	return "", fmt.Errorf("%w: %s", ErrNotFound, key)
 }
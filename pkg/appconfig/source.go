@@ -0,0 +1,47 @@
+package appconfig
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Source resolves configuration keys from a Provider for config.Bind
+type Source struct {
+	ctx      context.Context
+	provider Provider
+	mu       sync.Mutex
+	errs     []error
+}
+
+func NewSource(ctx context.Context, provider Provider) *Source {
+	return &Source{
+		ctx:      ctx,
+		provider: provider,
+	}
+}
+
+func (s *Source) Name() string {
+	return "appconfig"
+}
+
+func (s *Source) Lookup(key string) (string, bool) {
+	value, err := s.provider.GetConfiguration(s.ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return "", false
+	}
+	if err != nil {
+		s.mu.Lock()
+		s.errs = append(s.errs, err)
+		s.mu.Unlock()
+		return "", false
+	}
+	return value, true
+}
+
+// Err reports the lookups that failed for reasons other than a missing key
+func (s *Source) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.Join(s.errs...)
+}
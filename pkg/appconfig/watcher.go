@@ -0,0 +1,146 @@
+package appconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"scaler/pkg/config"
+	"scaler/pkg/logging"
+)
+
+// watchTimeout bounds a single refresh of the configuration
+const watchTimeout = 30 * time.Second
+
+// Watcher keeps the scaler settings current by polling a sentinel key and reloading on change.
+// App Config values override env vars and the config file, keys it does not set keep those values.
+// Services read the tunables they use per run (pool and warm pool size, worker pool size, timeouts,
+// retry backoff and runtime thresholds) from Current, so changes apply from the next run. The job
+// schedule, lease TTL and metrics address are only read at startup and still need a restart.
+type Watcher struct {
+	provider    Provider
+	sentinelKey string
+	interval    time.Duration
+	current     atomic.Pointer[config.ScalerConfig]
+	sentinel    string
+	loaded      bool
+	stopChan    chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewWatcher creates a watcher that serves fallback until the first successful load.
+// Without a sentinel key the full configuration is reloaded on every poll, without a
+// provider fallback is served for good.
+func NewWatcher(provider Provider, sentinelKey string, interval time.Duration, fallback *config.ScalerConfig) (*Watcher, error) {
+	// Validate mandatory parameters
+	if provider != nil && interval <= 0 {
+		return nil, fmt.Errorf("invalid refresh interval: %v, must be positive", interval)
+	}
+	if err := validate(fallback); err != nil {
+		return nil, fmt.Errorf("invalid fallback configuration: %w", err)
+	}
+
+	w := &Watcher{
+		provider:    provider,
+		sentinelKey: sentinelKey,
+		interval:    interval,
+		stopChan:    make(chan struct{}),
+	}
+	w.current.Store(fallback)
+	return w, nil
+}
+
+// Current returns the latest valid scaler settings, safe for concurrent use.
+// The returned config must not be modified.
+func (w *Watcher) Current() *config.ScalerConfig {
+	return w.current.Load()
+}
+
+// Start loads the configuration once and keeps polling for changes in the background
+func (w *Watcher) Start() {
+	if w.provider == nil {
+		return
+	}
+
+	w.refresh()
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.stopChan:
+				return
+			case <-ticker.C:
+				w.refresh()
+			}
+		}
+	}()
+}
+
+func (w *Watcher) Stop() {
+	close(w.stopChan)
+	w.wg.Wait()
+}
+
+func (w *Watcher) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), watchTimeout)
+	defer cancel()
+
+	// Only reload when the sentinel changed since the last successful load
+	sentinel := ""
+	if w.sentinelKey != "" {
+		value, err := w.provider.GetConfiguration(ctx, w.sentinelKey)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			// Without a sentinel every poll reloads
+		case err != nil:
+			slog.WarnContext(ctx, "Failed to check App Config sentinel", "key", w.sentinelKey, logging.Err(err))
+			return
+		case w.loaded && value == w.sentinel:
+			return
+		default:
+			sentinel = value
+		}
+	}
+
+	// Lookup failures would otherwise fall back to env values as if the keys were unset
+	source := NewSource(ctx, w.provider)
+	scalerConfig, report, err := config.LoadScalerConfigFrom(source)
+	if sourceErr := source.Err(); sourceErr != nil {
+		slog.WarnContext(ctx, "Failed to reload App Config, keeping current settings", logging.Err(sourceErr))
+		return
+	}
+	if err == nil {
+		err = validate(scalerConfig)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Rejected App Config settings, keeping current settings", logging.Err(err))
+		return
+	}
+
+	previous := w.current.Swap(scalerConfig)
+	w.sentinel = sentinel
+	w.loaded = true
+
+	if *previous != *scalerConfig {
+		slog.InfoContext(ctx, "Applied App Config settings", "config", report)
+	}
+}
+
+// validate checks the settings that depend on each other, single values are checked when binding
+func validate(scalerConfig *config.ScalerConfig) error {
+	if scalerConfig.RetryBackoffMax < scalerConfig.RetryBackoff {
+		return fmt.Errorf("invalid retry backoff: %d-%d, must be ordered",
+			scalerConfig.RetryBackoff, scalerConfig.RetryBackoffMax)
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package appgw
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+
+	"scaler/internal/vmss"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+)
+
+// managedPoolName matches the per-instance backend pools named after their private IP (e.g. 10-0-0-5)
+var managedPoolName = regexp.MustCompile(`^\d{1,3}-\d{1,3}-\d{1,3}-\d{1,3}$`)
+
+// desiredRule is the path rule an active instance should have
+type desiredRule struct {
+	Name         string
+	Paths        []string
+	Pool         string
+	Address      string
+	HTTPSettings string
+}
+
+// DriftReport describes how the gateway differs from the desired instance routing
+type DriftReport struct {
+	AddedRules          []string
+	RemovedRules        []string
+	ChangedRules        []string
+	AddedPools          []string
+	RemovedPools        []string
+	MissingHTTPSettings []string
+	UnmanagedRules      []string
+	TotalRules          int
+}
+
+// HasDrift reports whether the path rules need to be updated
+func (r *DriftReport) HasDrift() bool {
+	return len(r.AddedRules) > 0 || len(r.RemovedRules) > 0 || len(r.ChangedRules) > 0 ||
+		len(r.AddedPools) > 0 || len(r.RemovedPools) > 0
+}
+
+func (r *DriftReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "added %d, removed %d, changed %d, total %d rules",
+		len(r.AddedRules), len(r.RemovedRules), len(r.ChangedRules), r.TotalRules)
+
+	if len(r.AddedPools) > 0 || len(r.RemovedPools) > 0 {
+		fmt.Fprintf(&b, "; pools added %d, removed %d", len(r.AddedPools), len(r.RemovedPools))
+	}
+	if len(r.MissingHTTPSettings) > 0 {
+		fmt.Fprintf(&b, "; missing HTTP settings: %s", strings.Join(r.MissingHTTPSettings, ", "))
+	}
+
+	return b.String()
+}
+
+// LogValue groups the drift counts in structured logs
+func (r *DriftReport) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("addedRules", len(r.AddedRules)),
+		slog.Int("removedRules", len(r.RemovedRules)),
+		slog.Int("changedRules", len(r.ChangedRules)),
+		slog.Int("addedPools", len(r.AddedPools)),
+		slog.Int("removedPools", len(r.RemovedPools)),
+		slog.Any("missingHttpSettings", r.MissingHTTPSettings),
+		slog.Int("totalRules", r.TotalRules),
+	)
+}
+
+func (p *AzureAppGWProvider) desiredRules(instances []*vmss.VMInstance) map[string]desiredRule {
+	desired := make(map[string]desiredRule)
+	for _, instance := range instances {
+		if instance.PrivateIP == "" {
+			continue
+		}
+
+		for _, rule := range p.templates.render(instance) {
+			desired[rule.Name] = rule
+		}
+	}
+	return desired
+}
+
+// currentRules returns the managed rules of the path map as they are, so single instances can be
+// added or removed without touching the others. Rules missing their pool or HTTP settings are
+// left out and therefore removed.
+func (p *AzureAppGWProvider) currentRules(pathMap *armnetwork.ApplicationGatewayURLPathMap) map[string]desiredRule {
+	current := make(map[string]desiredRule)
+	for _, rule := range pathMap.Properties.PathRules {
+		name := *rule.Name
+		props := rule.Properties
+		if !p.templates.isManaged(name) || props == nil ||
+			props.BackendAddressPool == nil || props.BackendAddressPool.ID == nil ||
+			props.BackendHTTPSettings == nil || props.BackendHTTPSettings.ID == nil {
+			continue
+		}
+
+		paths := make([]string, 0, len(props.Paths))
+		for _, path := range props.Paths {
+			if path != nil {
+				paths = append(paths, *path)
+			}
+		}
+
+		// Instance pools are named after the private IP, used to recreate a pool deleted by hand
+		pool := resourceName(*props.BackendAddressPool.ID)
+		address := ""
+		if managedPoolName.MatchString(pool) {
+			address = strings.ReplaceAll(pool, "-", ".")
+		}
+
+		current[name] = desiredRule{
+			Name:         name,
+			Paths:        paths,
+			Pool:         pool,
+			Address:      address,
+			HTTPSettings: resourceName(*props.BackendHTTPSettings.ID),
+		}
+	}
+	return current
+}
+
+// resourceName returns the last segment of a resource ID
+func resourceName(id string) string {
+	return id[strings.LastIndex(id, "/")+1:]
+}
+
+// reconcileRules diffs the path map against the desired rules and returns the rules it should hold.
+// Backend pools for new instances are added to the gateway as a side effect.
+func (p *AzureAppGWProvider) reconcileRules(
+	gateway *armnetwork.ApplicationGateway,
+	pathMap *armnetwork.ApplicationGatewayURLPathMap,
+	desired map[string]desiredRule,
+) (*DriftReport, []*armnetwork.ApplicationGatewayPathRule) {
+	report := &DriftReport{}
+
+	pools := make(map[string]bool)
+	for _, pool := range gateway.Properties.BackendAddressPools {
+		pools[*pool.Name] = true
+	}
+
+	settings := make(map[string]bool)
+	for _, setting := range gateway.Properties.BackendHTTPSettingsCollection {
+		settings[*setting.Name] = true
+	}
+
+	rules := make([]*armnetwork.ApplicationGatewayPathRule, 0, len(pathMap.Properties.PathRules))
+	seen := make(map[string]bool)
+
+	for _, rule := range pathMap.Properties.PathRules {
+		name := *rule.Name
+
+		// Keep rules the scaler does not own
+		if !p.templates.isManaged(name) {
+			report.UnmanagedRules = append(report.UnmanagedRules, name)
+			rules = append(rules, rule)
+			continue
+		}
+
+		want, exists := desired[name]
+		if !exists {
+			report.RemovedRules = append(report.RemovedRules, name)
+			continue
+		}
+		seen[name] = true
+
+		if !p.ensureRoutable(gateway, want, pools, settings, report) {
+			report.RemovedRules = append(report.RemovedRules, name)
+			continue
+		}
+
+		if !p.ruleMatches(rule, want) {
+			report.ChangedRules = append(report.ChangedRules, name)
+			rule = p.newRule(want)
+		}
+		rules = append(rules, rule)
+	}
+
+	// Add rules for new instances in a stable order
+	names := make([]string, 0, len(desired))
+	for name := range desired {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		want := desired[name]
+		if !p.ensureRoutable(gateway, want, pools, settings, report) {
+			continue
+		}
+		report.AddedRules = append(report.AddedRules, name)
+		rules = append(rules, p.newRule(want))
+	}
+
+	report.TotalRules = len(rules)
+	return report, rules
+}
+
+// ensureRoutable reports whether the HTTP settings a rule references exist on the gateway,
+// creating the rule's backend pool when it is missing
+func (p *AzureAppGWProvider) ensureRoutable(
+	gateway *armnetwork.ApplicationGateway,
+	want desiredRule,
+	pools, settings map[string]bool,
+	report *DriftReport,
+) bool {
+	if !settings[want.HTTPSettings] {
+		report.MissingHTTPSettings = appendUnique(report.MissingHTTPSettings, want.HTTPSettings)
+		return false
+	}
+
+	if !pools[want.Pool] {
+		gateway.Properties.BackendAddressPools = append(gateway.Properties.BackendAddressPools,
+			&armnetwork.ApplicationGatewayBackendAddressPool{
+				Name: to.Ptr(want.Pool),
+				Properties: &armnetwork.ApplicationGatewayBackendAddressPoolPropertiesFormat{
+					BackendAddresses: []*armnetwork.ApplicationGatewayBackendAddress{
+						{IPAddress: to.Ptr(want.Address)},
+					},
+				},
+			})
+		pools[want.Pool] = true
+		report.AddedPools = append(report.AddedPools, want.Pool)
+	}
+
+	return true
+}
+
+// prunePools removes managed backend pools no longer referenced by any rule or listener routing
+func (p *AzureAppGWProvider) prunePools(gateway *armnetwork.ApplicationGateway, report *DriftReport) {
+	referenced := make(map[string]bool)
+	reference := func(resource *armnetwork.SubResource) {
+		if resource != nil && resource.ID != nil {
+			referenced[strings.ToLower(*resource.ID)] = true
+		}
+	}
+
+	for _, pm := range gateway.Properties.URLPathMaps {
+		if pm.Properties == nil {
+			continue
+		}
+		reference(pm.Properties.DefaultBackendAddressPool)
+		for _, rule := range pm.Properties.PathRules {
+			if rule.Properties != nil {
+				reference(rule.Properties.BackendAddressPool)
+			}
+		}
+	}
+	for _, rule := range gateway.Properties.RequestRoutingRules {
+		if rule.Properties != nil {
+			reference(rule.Properties.BackendAddressPool)
+		}
+	}
+
+	pools := make([]*armnetwork.ApplicationGatewayBackendAddressPool, 0, len(gateway.Properties.BackendAddressPools))
+	for _, pool := range gateway.Properties.BackendAddressPools {
+		name := *pool.Name
+		if managedPoolName.MatchString(name) && !referenced[strings.ToLower(p.resourceID("backendAddressPools", name))] {
+			report.RemovedPools = append(report.RemovedPools, name)
+			continue
+		}
+		pools = append(pools, pool)
+	}
+	gateway.Properties.BackendAddressPools = pools
+}
+
+func (p *AzureAppGWProvider) ruleMatches(rule *armnetwork.ApplicationGatewayPathRule, want desiredRule) bool {
+	props := rule.Properties
+	if props == nil || len(props.Paths) != len(want.Paths) {
+		return false
+	}
+	for i, path := range props.Paths {
+		if path == nil || *path != want.Paths[i] {
+			return false
+		}
+	}
+	if props.BackendAddressPool == nil || props.BackendAddressPool.ID == nil ||
+		!strings.EqualFold(*props.BackendAddressPool.ID, p.resourceID("backendAddressPools", want.Pool)) {
+		return false
+	}
+	if props.BackendHTTPSettings == nil || props.BackendHTTPSettings.ID == nil ||
+		!strings.EqualFold(*props.BackendHTTPSettings.ID, p.resourceID("backendHttpSettingsCollection", want.HTTPSettings)) {
+		return false
+	}
+	return true
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,390 @@
+package appgw
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"scaler/internal/vmss"
+	"scaler/pkg/config"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+)
+
+func newTestProvider(t *testing.T) *AzureAppGWProvider {
+	t.Helper()
+	cfg := &config.AppGWConfig{
+		SubscriptionID: "sub",
+		ResourceGroup:  "rg",
+		GWName:         "gw",
+		PathMapName:    "paths",
+		RuleNameFormat: "instance{instanceId}",
+		Routes:         []config.AppGWRoute{{Paths: []string{"/{vmid}"}, HTTPSettings: "wss"}},
+		ProtectedRules: []string{"instance-admin"},
+	}
+
+	templates, err := newRuleTemplates(cfg)
+	if err != nil {
+		t.Fatalf("failed to create rule templates: %v", err)
+	}
+	return &AzureAppGWProvider{
+		config:    cfg,
+		templates: templates,
+	}
+}
+
+func testInstance(instanceID, privateIP string) *vmss.VMInstance {
+	return &vmss.VMInstance{
+		VMID:       "vm-" + instanceID,
+		InstanceID: instanceID,
+		PrivateIP:  privateIP,
+	}
+}
+
+// testRule builds a path rule as the scaler would create it
+func testRule(p *AzureAppGWProvider, name, path, pool string) *armnetwork.ApplicationGatewayPathRule {
+	return &armnetwork.ApplicationGatewayPathRule{
+		Name: to.Ptr(name),
+		Properties: &armnetwork.ApplicationGatewayPathRulePropertiesFormat{
+			Paths:               to.SliceOfPtrs(path),
+			BackendAddressPool:  &armnetwork.SubResource{ID: to.Ptr(p.resourceID("backendAddressPools", pool))},
+			BackendHTTPSettings: &armnetwork.SubResource{ID: to.Ptr(p.resourceID("backendHttpSettingsCollection", "wss"))},
+		},
+	}
+}
+
+func testGateway(pools []string, settings []string, rules ...*armnetwork.ApplicationGatewayPathRule) *armnetwork.ApplicationGateway {
+	gateway := &armnetwork.ApplicationGateway{
+		Properties: &armnetwork.ApplicationGatewayPropertiesFormat{
+			URLPathMaps: []*armnetwork.ApplicationGatewayURLPathMap{{
+				Name: to.Ptr("paths"),
+				Properties: &armnetwork.ApplicationGatewayURLPathMapPropertiesFormat{
+					PathRules: rules,
+				},
+			}},
+		},
+	}
+	for _, pool := range pools {
+		gateway.Properties.BackendAddressPools = append(gateway.Properties.BackendAddressPools,
+			&armnetwork.ApplicationGatewayBackendAddressPool{Name: to.Ptr(pool)})
+	}
+	for _, setting := range settings {
+		gateway.Properties.BackendHTTPSettingsCollection = append(gateway.Properties.BackendHTTPSettingsCollection,
+			&armnetwork.ApplicationGatewayBackendHTTPSettings{Name: to.Ptr(setting)})
+	}
+	return gateway
+}
+
+func ruleNames(rules []*armnetwork.ApplicationGatewayPathRule) []string {
+	names := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		names = append(names, *rule.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func poolNames(gateway *armnetwork.ApplicationGateway) []string {
+	names := make([]string, 0, len(gateway.Properties.BackendAddressPools))
+	for _, pool := range gateway.Properties.BackendAddressPools {
+		names = append(names, *pool.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestReconcileRules(t *testing.T) {
+	p := newTestProvider(t)
+
+	tests := []struct {
+		name        string
+		pools       []string
+		settings    []string
+		rules       []*armnetwork.ApplicationGatewayPathRule
+		instances   []*vmss.VMInstance
+		wantRules   []string
+		wantPools   []string
+		wantReport  DriftReport
+		wantDrift   bool
+		wantChanged string
+	}{
+		{
+			name:      "add",
+			settings:  []string{"wss"},
+			instances: []*vmss.VMInstance{testInstance("1", "10.0.0.5")},
+			wantRules: []string{"instance1"},
+			wantPools: []string{"10-0-0-5"},
+			wantReport: DriftReport{
+				AddedRules: []string{"instance1"},
+				AddedPools: []string{"10-0-0-5"},
+				TotalRules: 1,
+			},
+			wantDrift: true,
+		},
+		{
+			name:      "remove",
+			pools:     []string{"10-0-0-5"},
+			settings:  []string{"wss"},
+			rules:     []*armnetwork.ApplicationGatewayPathRule{testRule(p, "instance1", "/vm-1", "10-0-0-5")},
+			wantRules: []string{},
+			wantPools: []string{"10-0-0-5"},
+			wantReport: DriftReport{
+				RemovedRules: []string{"instance1"},
+			},
+			wantDrift: true,
+		},
+		{
+			name:      "unchanged",
+			pools:     []string{"10-0-0-5"},
+			settings:  []string{"wss"},
+			rules:     []*armnetwork.ApplicationGatewayPathRule{testRule(p, "instance1", "/vm-1", "10-0-0-5")},
+			instances: []*vmss.VMInstance{testInstance("1", "10.0.0.5")},
+			wantRules: []string{"instance1"},
+			wantPools: []string{"10-0-0-5"},
+			wantReport: DriftReport{
+				TotalRules: 1,
+			},
+		},
+		{
+			name:      "drifted path",
+			pools:     []string{"10-0-0-5"},
+			settings:  []string{"wss"},
+			rules:     []*armnetwork.ApplicationGatewayPathRule{testRule(p, "instance1", "/edited", "10-0-0-5")},
+			instances: []*vmss.VMInstance{testInstance("1", "10.0.0.5")},
+			wantRules: []string{"instance1"},
+			wantPools: []string{"10-0-0-5"},
+			wantReport: DriftReport{
+				ChangedRules: []string{"instance1"},
+				TotalRules:   1,
+			},
+			wantDrift:   true,
+			wantChanged: "instance1",
+		},
+		{
+			name:      "drifted pool after new private IP",
+			pools:     []string{"10-0-0-5"},
+			settings:  []string{"wss"},
+			rules:     []*armnetwork.ApplicationGatewayPathRule{testRule(p, "instance1", "/vm-1", "10-0-0-5")},
+			instances: []*vmss.VMInstance{testInstance("1", "10.0.0.9")},
+			wantRules: []string{"instance1"},
+			wantPools: []string{"10-0-0-5", "10-0-0-9"},
+			wantReport: DriftReport{
+				ChangedRules: []string{"instance1"},
+				AddedPools:   []string{"10-0-0-9"},
+				TotalRules:   1,
+			},
+			wantDrift:   true,
+			wantChanged: "instance1",
+		},
+		{
+			name:     "unmanaged and protected rules kept",
+			settings: []string{"wss"},
+			rules: []*armnetwork.ApplicationGatewayPathRule{
+				testRule(p, "static", "/static/*", "web"),
+				testRule(p, "instance-admin", "/admin", "web"),
+			},
+			wantRules: []string{"instance-admin", "static"},
+			wantPools: []string{},
+			wantReport: DriftReport{
+				UnmanagedRules: []string{"static", "instance-admin"},
+				TotalRules:     2,
+			},
+		},
+		{
+			name:      "missing HTTP settings",
+			settings:  []string{"https"},
+			rules:     []*armnetwork.ApplicationGatewayPathRule{testRule(p, "instance1", "/vm-1", "10-0-0-5")},
+			instances: []*vmss.VMInstance{testInstance("1", "10.0.0.5"), testInstance("2", "10.0.0.6")},
+			wantRules: []string{},
+			wantPools: []string{},
+			wantReport: DriftReport{
+				RemovedRules:        []string{"instance1"},
+				MissingHTTPSettings: []string{"wss"},
+			},
+			wantDrift: true,
+		},
+		{
+			name:      "instance without private IP",
+			settings:  []string{"wss"},
+			instances: []*vmss.VMInstance{testInstance("1", "")},
+			wantRules: []string{},
+			wantPools: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := testGateway(tt.pools, tt.settings, tt.rules...)
+			pathMap := gateway.Properties.URLPathMaps[0]
+
+			report, rules := p.reconcileRules(gateway, pathMap, p.desiredRules(tt.instances))
+
+			if got := ruleNames(rules); !reflect.DeepEqual(got, tt.wantRules) {
+				t.Errorf("rules = %v, want %v", got, tt.wantRules)
+			}
+			if got := poolNames(gateway); !reflect.DeepEqual(got, tt.wantPools) {
+				t.Errorf("pools = %v, want %v", got, tt.wantPools)
+			}
+			if !reflect.DeepEqual(*report, tt.wantReport) {
+				t.Errorf("report = %+v, want %+v", *report, tt.wantReport)
+			}
+			if report.HasDrift() != tt.wantDrift {
+				t.Errorf("HasDrift() = %v, want %v", report.HasDrift(), tt.wantDrift)
+			}
+
+			// Changed rules are rebuilt from the template
+			for _, rule := range rules {
+				if *rule.Name == tt.wantChanged {
+					want := p.desiredRules(tt.instances)[tt.wantChanged]
+					if !p.ruleMatches(rule, want) {
+						t.Errorf("rule %s was not rewritten to %+v", tt.wantChanged, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPrunePools(t *testing.T) {
+	p := newTestProvider(t)
+
+	tests := []struct {
+		name        string
+		pools       []string
+		rules       []*armnetwork.ApplicationGatewayPathRule
+		defaultPool string
+		routingPool string
+		wantPools   []string
+		wantRemoved []string
+	}{
+		{
+			name:      "referenced by path rule",
+			pools:     []string{"10-0-0-5"},
+			rules:     []*armnetwork.ApplicationGatewayPathRule{testRule(p, "instance1", "/vm-1", "10-0-0-5")},
+			wantPools: []string{"10-0-0-5"},
+		},
+		{
+			name:        "orphaned",
+			pools:       []string{"10-0-0-5", "10-0-0-6"},
+			rules:       []*armnetwork.ApplicationGatewayPathRule{testRule(p, "instance1", "/vm-1", "10-0-0-5")},
+			wantPools:   []string{"10-0-0-5"},
+			wantRemoved: []string{"10-0-0-6"},
+		},
+		{
+			name:        "referenced as path map default",
+			pools:       []string{"10-0-0-5"},
+			defaultPool: "10-0-0-5",
+			wantPools:   []string{"10-0-0-5"},
+		},
+		{
+			name:        "referenced by routing rule",
+			pools:       []string{"10-0-0-5"},
+			routingPool: "10-0-0-5",
+			wantPools:   []string{"10-0-0-5"},
+		},
+		{
+			name:      "unmanaged pool kept",
+			pools:     []string{"web"},
+			wantPools: []string{"web"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := testGateway(tt.pools, []string{"wss"}, tt.rules...)
+			if tt.defaultPool != "" {
+				gateway.Properties.URLPathMaps[0].Properties.DefaultBackendAddressPool = &armnetwork.SubResource{
+					ID: to.Ptr(p.resourceID("backendAddressPools", tt.defaultPool)),
+				}
+			}
+			if tt.routingPool != "" {
+				gateway.Properties.RequestRoutingRules = []*armnetwork.ApplicationGatewayRequestRoutingRule{{
+					Name: to.Ptr("basic"),
+					Properties: &armnetwork.ApplicationGatewayRequestRoutingRulePropertiesFormat{
+						BackendAddressPool: &armnetwork.SubResource{ID: to.Ptr(p.resourceID("backendAddressPools", tt.routingPool))},
+					},
+				}}
+			}
+
+			report := &DriftReport{}
+			p.prunePools(gateway, report)
+
+			if got := poolNames(gateway); !reflect.DeepEqual(got, tt.wantPools) {
+				t.Errorf("pools = %v, want %v", got, tt.wantPools)
+			}
+			if !reflect.DeepEqual(report.RemovedPools, tt.wantRemoved) {
+				t.Errorf("RemovedPools = %v, want %v", report.RemovedPools, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestCurrentRules(t *testing.T) {
+	p := newTestProvider(t)
+
+	tests := []struct {
+		name       string
+		edit       func(desired map[string]desiredRule)
+		wantRules  []string
+		wantReport DriftReport
+	}{
+		{
+			name:       "unchanged",
+			edit:       func(desired map[string]desiredRule) {},
+			wantRules:  []string{"instance1", "instance2", "static"},
+			wantReport: DriftReport{UnmanagedRules: []string{"static"}, TotalRules: 3},
+		},
+		{
+			name: "add one instance",
+			edit: func(desired map[string]desiredRule) {
+				for name, rule := range p.desiredRules([]*vmss.VMInstance{testInstance("3", "10.0.0.7")}) {
+					desired[name] = rule
+				}
+			},
+			wantRules: []string{"instance1", "instance2", "instance3", "static"},
+			wantReport: DriftReport{
+				AddedRules:     []string{"instance3"},
+				AddedPools:     []string{"10-0-0-7"},
+				UnmanagedRules: []string{"static"},
+				TotalRules:     4,
+			},
+		},
+		{
+			name: "remove one instance",
+			edit: func(desired map[string]desiredRule) {
+				for _, rule := range p.templates.render(testInstance("1", "10.0.0.5")) {
+					delete(desired, rule.Name)
+				}
+			},
+			wantRules: []string{"instance2", "static"},
+			wantReport: DriftReport{
+				RemovedRules:   []string{"instance1"},
+				UnmanagedRules: []string{"static"},
+				TotalRules:     2,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := testGateway([]string{"10-0-0-5", "10-0-0-6", "web"}, []string{"wss"},
+				testRule(p, "instance1", "/vm-1", "10-0-0-5"),
+				testRule(p, "static", "/static/*", "web"),
+				testRule(p, "instance2", "/custom", "10-0-0-6"),
+			)
+			pathMap := gateway.Properties.URLPathMaps[0]
+
+			desired := p.currentRules(pathMap)
+			tt.edit(desired)
+			report, rules := p.reconcileRules(gateway, pathMap, desired)
+
+			if got := ruleNames(rules); !reflect.DeepEqual(got, tt.wantRules) {
+				t.Errorf("rules = %v, want %v", got, tt.wantRules)
+			}
+			if !reflect.DeepEqual(*report, tt.wantReport) {
+				t.Errorf("report = %+v, want %+v", *report, tt.wantReport)
+			}
+		})
+	}
+}
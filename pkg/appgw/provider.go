@@ -2,12 +2,18 @@ package appgw
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"scaler/internal/vmss"
 	"scaler/pkg/config"
-	"strings"
+	"scaler/pkg/logging"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
@@ -15,15 +21,38 @@ import (
 
 // Provider defines operations for managing Application Gateway path-based rules
 type Provider interface {
-	UpdatePathBasedRules(ctx context.Context, instances []*vmss.VMInstance) error
+	UpdatePathBasedRules(ctx context.Context, instances []*vmss.VMInstance) (*DriftReport, error)
+	AddInstanceRules(ctx context.Context, instance *vmss.VMInstance) (*DriftReport, error)
+	RemoveInstanceRules(ctx context.Context, instance *vmss.VMInstance) (*DriftReport, error)
 }
 
+const (
+	// maxConflictRetries bounds re-diffing after concurrent gateway edits
+	maxConflictRetries = 3
+
+	updatePollFrequency = 10 * time.Second
+)
+
+// conflictRetryDelay grows linearly with the attempt, shortened in tests
+var conflictRetryDelay = 5 * time.Second
+
 type AzureAppGWProvider struct {
-	client *armnetwork.ApplicationGatewaysClient
-	config *config.AppGWConfig
+	client    *armnetwork.ApplicationGatewaysClient
+	config    *config.AppGWConfig
+	templates *ruleTemplates
 }
 
 func NewAzureAppGWProvider(cfg *config.AppGWConfig) (*AzureAppGWProvider, error) {
+	// Validate mandatory parameters
+	if cfg.GWName == "" || cfg.PathMapName == "" {
+		return nil, fmt.Errorf("app gateway name and URL path map name are required")
+	}
+
+	templates, err := newRuleTemplates(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid routing templates: %w", err)
+	}
+
 	cred, err := azidentity.NewDefaultAzureCredential(nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create credential: %v", err)
@@ -35,15 +64,76 @@ func NewAzureAppGWProvider(cfg *config.AppGWConfig) (*AzureAppGWProvider, error)
 	}
 
 	return &AzureAppGWProvider{
-		client: client,
-		config: cfg,
+		client:    client,
+		config:    cfg,
+		templates: templates,
 	}, nil
 }
 
-func (p *AzureAppGWProvider) UpdatePathBasedRules(ctx context.Context, instances []*vmss.VMInstance) error {
+// UpdatePathBasedRules makes the instance rules match the given instances, removing the rules of any other instance
+func (p *AzureAppGWProvider) UpdatePathBasedRules(ctx context.Context, instances []*vmss.VMInstance) (*DriftReport, error) {
+	desired := p.desiredRules(instances)
+	return p.update(ctx, func(*armnetwork.ApplicationGatewayURLPathMap) map[string]desiredRule {
+		return desired
+	})
+}
+
+// AddInstanceRules adds the rules of one instance and leaves the rules of the other instances as they are
+func (p *AzureAppGWProvider) AddInstanceRules(ctx context.Context, instance *vmss.VMInstance) (*DriftReport, error) {
+	return p.update(ctx, func(pathMap *armnetwork.ApplicationGatewayURLPathMap) map[string]desiredRule {
+		desired := p.currentRules(pathMap)
+		for name, rule := range p.desiredRules([]*vmss.VMInstance{instance}) {
+			desired[name] = rule
+		}
+		return desired
+	})
+}
+
+// RemoveInstanceRules removes the rules of one instance and leaves the rules of the other instances as they are
+func (p *AzureAppGWProvider) RemoveInstanceRules(ctx context.Context, instance *vmss.VMInstance) (*DriftReport, error) {
+	return p.update(ctx, func(pathMap *armnetwork.ApplicationGatewayURLPathMap) map[string]desiredRule {
+		desired := p.currentRules(pathMap)
+		for _, rule := range p.templates.render(instance) {
+			delete(desired, rule.Name)
+		}
+		return desired
+	})
+}
+
+// update applies the rules returned by desiredFor, which is evaluated against the path map of every attempt
+func (p *AzureAppGWProvider) update(
+	ctx context.Context,
+	desiredFor func(pathMap *armnetwork.ApplicationGatewayURLPathMap) map[string]desiredRule,
+) (*DriftReport, error) {
+	for attempt := 1; ; attempt++ {
+		report, err := p.updatePathBasedRules(ctx, desiredFor)
+		if err == nil {
+			return report, nil
+		}
+
+		// Someone else changed the gateway since it was read, diff again against their edits
+		if !isConflict(err) || attempt >= maxConflictRetries {
+			return report, err
+		}
+
+		slog.WarnContext(ctx, "Application gateway changed concurrently, retrying",
+			"attempt", attempt, "maxAttempts", maxConflictRetries, logging.Err(err))
+
+		select {
+		case <-ctx.Done():
+			return report, ctx.Err()
+		case <-time.After(time.Duration(attempt) * conflictRetryDelay):
+		}
+	}
+}
+
+func (p *AzureAppGWProvider) updatePathBasedRules(
+	ctx context.Context,
+	desiredFor func(pathMap *armnetwork.ApplicationGatewayURLPathMap) map[string]desiredRule,
+) (*DriftReport, error) {
 	gateway, err := p.client.Get(ctx, p.config.ResourceGroup, p.config.GWName, nil)
 	if err != nil {
-		return fmt.Errorf("failed to get app gateway: %w", err)
+		return nil, fmt.Errorf("failed to get app gateway: %w", err)
 	}
 
 	// Find the URL path map
@@ -56,106 +146,81 @@ func (p *AzureAppGWProvider) UpdatePathBasedRules(ctx context.Context, instances
 	}
 
 	if pathMap == nil {
-		return fmt.Errorf("URL path map %s not found", p.config.PathMapName)
+		return nil, fmt.Errorf("URL path map %s not found", p.config.PathMapName)
 	}
 
-	// Create map of current instances by VMID for quick lookup
-	activeInstances := make(map[string]*vmss.VMInstance)
-	for _, instance := range instances {
-		if instance.PrivateIP != "" {
-			activeInstances[instance.VMID] = instance
-		}
-	}
+	report, rules := p.reconcileRules(&gateway.ApplicationGateway, pathMap, desiredFor(pathMap))
 
-	updateFlag := false
+	// Without the HTTP settings every instance rule would be dropped
+	if len(report.MissingHTTPSettings) > 0 {
+		return report, fmt.Errorf("backend HTTP settings %v not found", report.MissingHTTPSettings)
+	}
 
-	// Track changes
-	changes := struct {
-		added   int
-		removed int
-	}{0, 0}
+	// Update path map with reconciled rules and drop the pools they no longer use
+	pathMap.Properties.PathRules = rules
+	p.prunePools(&gateway.ApplicationGateway, report)
 
-	// Filter out old rules
-	validRules := make([]*armnetwork.ApplicationGatewayPathRule, 0)
-	for _, rule := range pathMap.Properties.PathRules {
-		if len(rule.Properties.Paths) == 0 {
-			continue
-		}
+	if !report.HasDrift() {
+		slog.DebugContext(ctx, "No changes needed for path rules", "totalRules", report.TotalRules)
+		return report, nil
+	}
 
-		// Extract VMID from path pattern
-		vmid := strings.TrimPrefix(*rule.Properties.Paths[0], "/")
+	// Only overwrite the gateway version that was diffed against
+	updateCtx := ctx
+	if gateway.Etag != nil {
+		updateCtx = policy.WithHTTPHeader(ctx, http.Header{"If-Match": []string{*gateway.Etag}})
+	}
 
-		if vmid == "default" {
-			// Keep default rule
-			validRules = append(validRules, rule)
-			continue
-		}
+	slog.InfoContext(ctx, "Updating path rules", "drift", report)
 
-		// Check if instance still exists
-		if _, exists := activeInstances[vmid]; exists {
-			validRules = append(validRules, rule)
-			delete(activeInstances, vmid) // Remove from map to track new instances
-		} else {
-			updateFlag = true
-			changes.removed++
-		}
+	poller, err := p.client.BeginCreateOrUpdate(updateCtx, p.config.ResourceGroup, p.config.GWName, gateway.ApplicationGateway, nil)
+	if err != nil {
+		return report, fmt.Errorf("failed to update application gateway: %w", err)
 	}
 
-	// Add rules for new instances
-	if len(activeInstances) > 0 {
-		updateFlag = true
-		for vmid, instance := range activeInstances {
-			targetName := fmt.Sprintf("instance%s", instance.InstanceID)
-			pathPattern := fmt.Sprintf("/%s", vmid)
-			poolName := strings.ReplaceAll(instance.PrivateIP, ".", "-")
-
-			changes.added++
-
-			newRule := &armnetwork.ApplicationGatewayPathRule{
-				Name: to.Ptr(targetName),
-				Properties: &armnetwork.ApplicationGatewayPathRulePropertiesFormat{
-					Paths: []*string{to.Ptr(pathPattern)},
-					BackendAddressPool: &armnetwork.SubResource{
-						ID: to.Ptr(fmt.Sprintf(
-							"/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/applicationGateways/%s/backendAddressPools/%s",
-							p.config.SubscriptionID,
-							p.config.ResourceGroup,
-							p.config.GWName,
-							poolName,
-						)),
-					},
-					BackendHTTPSettings: &armnetwork.SubResource{
-						ID: to.Ptr(fmt.Sprintf(
-							"/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/applicationGateways/%s/backendHttpSettingsCollection/wss",
-							p.config.SubscriptionID,
-							p.config.ResourceGroup,
-							p.config.GWName,
-						)),
-					},
-				},
-			}
-			validRules = append(validRules, newRule)
-		}
-	}
+	// Wait for the update to complete
+	pollCtx, cancel := context.WithTimeout(ctx, time.Duration(p.config.UpdateTimeout)*time.Second)
+	defer cancel()
 
-	if updateFlag {
-		// Update path map with valid rules
-		pathMap.Properties.PathRules = validRules
+	if _, err := poller.PollUntilDone(pollCtx, &runtime.PollUntilDoneOptions{Frequency: updatePollFrequency}); err != nil {
+		return report, fmt.Errorf("failed to wait for application gateway update: %w", err)
+	}
 
-		// Update the gateway
-		_, err = p.client.BeginCreateOrUpdate(ctx, p.config.ResourceGroup, p.config.GWName, gateway.ApplicationGateway, nil)
-		if err != nil {
-			return fmt.Errorf("failed to update application gateway: %w", err)
-		}
+	slog.InfoContext(ctx, "Completed path rules update", "drift", report)
+	return report, nil
+}
 
-		log.Printf("Started path rules update: added %d, removed %d, total %d rules",
-			changes.added,
-			changes.removed,
-			len(validRules),
-		)
-	} else {
-		log.Printf("No changes needed for path rules (total: %d)", len(validRules))
+func (p *AzureAppGWProvider) newRule(want desiredRule) *armnetwork.ApplicationGatewayPathRule {
+	return &armnetwork.ApplicationGatewayPathRule{
+		Name: to.Ptr(want.Name),
+		Properties: &armnetwork.ApplicationGatewayPathRulePropertiesFormat{
+			Paths: to.SliceOfPtrs(want.Paths...),
+			BackendAddressPool: &armnetwork.SubResource{
+				ID: to.Ptr(p.resourceID("backendAddressPools", want.Pool)),
+			},
+			BackendHTTPSettings: &armnetwork.SubResource{
+				ID: to.Ptr(p.resourceID("backendHttpSettingsCollection", want.HTTPSettings)),
+			},
+		},
 	}
+}
 
-	return nil
+func (p *AzureAppGWProvider) resourceID(collection, name string) string {
+	return fmt.Sprintf(
+		"/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/applicationGateways/%s/%s/%s",
+		p.config.SubscriptionID,
+		p.config.ResourceGroup,
+		p.config.GWName,
+		collection,
+		name,
+	)
+}
+
+// isConflict reports whether the update lost a race with another gateway edit
+func isConflict(err error) bool {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return false
+	}
+	return respErr.StatusCode == http.StatusPreconditionFailed || respErr.StatusCode == http.StatusConflict
 }
@@ -0,0 +1,123 @@
+package appgw
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"scaler/internal/vmss"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+)
+
+// staticCredential authenticates against the fake gateway
+type staticCredential struct{}
+
+func (staticCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// fakeGateway serves a gateway whose ETag changes on every read, as if edited concurrently,
+// and rejects the first update with a stale ETag
+type fakeGateway struct {
+	mu        sync.Mutex
+	version   int
+	conflicts int
+	ifMatch   []string
+	updated   *armnetwork.ApplicationGateway
+}
+
+func (f *fakeGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		f.version++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name": "gw",
+			"etag": fmt.Sprintf(`W/"%d"`, f.version),
+			"properties": map[string]interface{}{
+				"backendHttpSettingsCollection": []map[string]interface{}{{"name": "wss"}},
+				"urlPathMaps": []map[string]interface{}{{
+					"name":       "paths",
+					"properties": map[string]interface{}{"pathRules": []interface{}{}},
+				}},
+			},
+		})
+	case http.MethodPut:
+		f.ifMatch = append(f.ifMatch, r.Header.Get("If-Match"))
+		if f.conflicts > 0 {
+			f.conflicts--
+			w.WriteHeader(http.StatusPreconditionFailed)
+			fmt.Fprint(w, `{"error":{"code":"PreconditionFailed","message":"The ETag does not match"}}`)
+			return
+		}
+
+		var gateway armnetwork.ApplicationGateway
+		if err := json.NewDecoder(r.Body).Decode(&gateway); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.updated = &gateway
+		fmt.Fprint(w, `{"name":"gw","properties":{"provisioningState":"Succeeded"}}`)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestUpdatePathBasedRulesConflict(t *testing.T) {
+	previousDelay := conflictRetryDelay
+	conflictRetryDelay = time.Millisecond
+	defer func() { conflictRetryDelay = previousDelay }()
+
+	fake := &fakeGateway{conflicts: 1}
+	server := httptest.NewTLSServer(fake)
+	defer server.Close()
+
+	client, err := armnetwork.NewApplicationGatewaysClient("sub", staticCredential{}, &arm.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			Cloud: cloud.Configuration{
+				Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+					cloud.ResourceManager: {Audience: "https://management.azure.com", Endpoint: server.URL},
+				},
+			},
+			Transport: server.Client(),
+		},
+		DisableRPRegistration: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create gateway client: %v", err)
+	}
+
+	p := newTestProvider(t)
+	p.client = client
+
+	report, err := p.UpdatePathBasedRules(context.Background(), []*vmss.VMInstance{testInstance("1", "10.0.0.5")})
+	if err != nil {
+		t.Fatalf("UpdatePathBasedRules() error = %v", err)
+	}
+
+	// Each attempt must be conditional on the version it was diffed against
+	want := []string{`W/"1"`, `W/"2"`}
+	if strings.Join(fake.ifMatch, " ") != strings.Join(want, " ") {
+		t.Errorf("If-Match = %v, want %v", fake.ifMatch, want)
+	}
+	if len(report.AddedRules) != 1 || report.AddedRules[0] != "instance1" {
+		t.Errorf("AddedRules = %v, want [instance1]", report.AddedRules)
+	}
+	if fake.updated == nil || len(fake.updated.Properties.URLPathMaps[0].Properties.PathRules) != 1 {
+		t.Fatalf("gateway was not updated with the new rule: %+v", fake.updated)
+	}
+}
@@ -0,0 +1,102 @@
+package appgw
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"scaler/internal/vmss"
+	"scaler/pkg/config"
+)
+
+// ruleTemplates renders the path rules of an instance from the configured routes
+type ruleTemplates struct {
+	nameFormat string
+	routes     []config.AppGWRoute
+	protected  map[string]bool
+	managed    *regexp.Regexp
+}
+
+func newRuleTemplates(cfg *config.AppGWConfig) (*ruleTemplates, error) {
+	if len(cfg.Routes) == 0 {
+		return nil, fmt.Errorf("no routes configured")
+	}
+	if !strings.Contains(cfg.RuleNameFormat, "{instanceId}") && !strings.Contains(cfg.RuleNameFormat, "{vmid}") {
+		return nil, fmt.Errorf("invalid rule name format %q, must contain {instanceId} or {vmid}", cfg.RuleNameFormat)
+	}
+	if len(cfg.Routes) > 1 && !strings.Contains(cfg.RuleNameFormat, "{route}") {
+		return nil, fmt.Errorf("invalid rule name format %q, must contain {route} with %d routes", cfg.RuleNameFormat, len(cfg.Routes))
+	}
+
+	names := make(map[string]bool)
+	for _, route := range cfg.Routes {
+		if len(route.Paths) == 0 {
+			return nil, fmt.Errorf("route %q has no paths", route.Name)
+		}
+		if route.HTTPSettings == "" {
+			return nil, fmt.Errorf("route %q has no HTTP settings", route.Name)
+		}
+		if names[route.Name] {
+			return nil, fmt.Errorf("duplicate route name %q", route.Name)
+		}
+		names[route.Name] = true
+	}
+
+	protected := make(map[string]bool)
+	for _, name := range cfg.ProtectedRules {
+		if name = strings.TrimSpace(name); name != "" {
+			protected[name] = true
+		}
+	}
+
+	// Rules whose names fit the format are owned by the scaler
+	pattern := regexp.QuoteMeta(cfg.RuleNameFormat)
+	pattern = strings.NewReplacer(
+		regexp.QuoteMeta("{instanceId}"), ".+",
+		regexp.QuoteMeta("{vmid}"), ".+",
+		regexp.QuoteMeta("{route}"), ".*",
+	).Replace(pattern)
+
+	managed, err := regexp.Compile("^" + pattern + "$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule name format %q: %w", cfg.RuleNameFormat, err)
+	}
+
+	return &ruleTemplates{
+		nameFormat: cfg.RuleNameFormat,
+		routes:     cfg.Routes,
+		protected:  protected,
+		managed:    managed,
+	}, nil
+}
+
+// isManaged reports whether a rule is owned by the scaler and may be changed or removed
+func (t *ruleTemplates) isManaged(name string) bool {
+	return !t.protected[name] && t.managed.MatchString(name)
+}
+
+// render returns the desired rules of an instance, one per route
+func (t *ruleTemplates) render(instance *vmss.VMInstance) []desiredRule {
+	rules := make([]desiredRule, 0, len(t.routes))
+	for _, route := range t.routes {
+		replacer := strings.NewReplacer(
+			"{vmid}", instance.VMID,
+			"{instanceId}", instance.InstanceID,
+			"{route}", route.Name,
+		)
+
+		paths := make([]string, 0, len(route.Paths))
+		for _, path := range route.Paths {
+			paths = append(paths, replacer.Replace(path))
+		}
+
+		rules = append(rules, desiredRule{
+			Name:         replacer.Replace(t.nameFormat),
+			Paths:        paths,
+			Pool:         strings.ReplaceAll(instance.PrivateIP, ".", "-"),
+			Address:      instance.PrivateIP,
+			HTTPSettings: route.HTTPSettings,
+		})
+	}
+	return rules
+}
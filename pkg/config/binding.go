@@ -0,0 +1,208 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Source resolves configuration keys, later sources take precedence over earlier ones
+type Source interface {
+	Name() string
+	Lookup(key string) (string, bool)
+}
+
+// EnvSource resolves keys from environment variables
+type EnvSource struct{}
+
+func (EnvSource) Name() string {
+	return "env"
+}
+
+func (EnvSource) Lookup(key string) (string, bool) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return "", false
+	}
+	return value, true
+}
+
+// MapSource resolves keys from an in-memory map, e.g. a parsed file or remote snapshot
+type MapSource struct {
+	SourceName string
+	Values     map[string]string
+}
+
+func (s *MapSource) Name() string {
+	return s.SourceName
+}
+
+func (s *MapSource) Lookup(key string) (string, bool) {
+	value, ok := s.Values[key]
+	return value, ok
+}
+
+// Binding records where the effective value of a key came from
+type Binding struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+// Report lists the effective value and source of every bound key
+type Report []Binding
+
+// LogValue logs the report as one attribute per key
+func (r Report) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, len(r))
+	for _, b := range r {
+		attrs = append(attrs, slog.String(b.Key, fmt.Sprintf("%s (%s)", b.Value, b.Source)))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func (r Report) String() string {
+	lines := make([]string, 0, len(r))
+	for _, b := range r {
+		lines = append(lines, fmt.Sprintf("%s=%q (%s)", b.Key, b.Value, b.Source))
+	}
+	return strings.Join(lines, ", ")
+}
+
+// Bind populates the tagged fields of target from defaults and sources in increasing precedence.
+// Supported tags: key (configuration key), default, required, secret (masked in the report),
+// min and max (for integers). Durations are parsed like "90s", fields other than strings,
+// integers, booleans, durations and string lists are decoded from JSON.
+// All invalid values are reported together.
+func Bind(target any, sources ...Source) (Report, error) {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("bind target must be a pointer to a struct, got %T", target)
+	}
+	value = value.Elem()
+
+	var report Report
+	var errs []error
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		key := field.Tag.Get("key")
+		if key == "" {
+			continue
+		}
+
+		raw, source := field.Tag.Get("default"), "default"
+		for _, s := range sources {
+			if v, ok := s.Lookup(key); ok {
+				raw, source = v, s.Name()
+			}
+		}
+
+		if source == "default" && field.Tag.Get("required") == "true" {
+			errs = append(errs, fmt.Errorf("%s is required", key))
+			continue
+		}
+
+		if err := setField(value.Field(i), raw); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s value %q from %s: %w", key, raw, source, err))
+			continue
+		}
+
+		if err := checkRange(value.Field(i), field.Tag); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s value %q from %s: %w", key, raw, source, err))
+			continue
+		}
+
+		if field.Tag.Get("secret") == "true" && raw != "" {
+			raw = "***"
+		}
+		report = append(report, Binding{Key: key, Value: raw, Source: source})
+	}
+
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Key < report[j].Key
+	})
+
+	return report, errors.Join(errs...)
+}
+
+func setField(field reflect.Value, raw string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		if raw == "" {
+			field.SetInt(0)
+			return nil
+		}
+		v, err := time.ParseDuration(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("not a duration")
+		}
+		field.SetInt(int64(v))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int:
+		if raw == "" {
+			field.SetInt(0)
+			return nil
+		}
+		v, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("not an integer")
+		}
+		field.SetInt(int64(v))
+	case reflect.Bool:
+		if raw == "" {
+			field.SetBool(false)
+			return nil
+		}
+		v, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("not a boolean")
+		}
+		field.SetBool(v)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.String {
+			field.Set(reflect.ValueOf(splitList(raw)))
+			return nil
+		}
+		fallthrough
+	default:
+		target := reflect.New(field.Type())
+		if raw != "" {
+			if err := json.Unmarshal([]byte(raw), target.Interface()); err != nil {
+				return fmt.Errorf("not valid JSON for %s: %w", field.Type(), err)
+			}
+		}
+		field.Set(target.Elem())
+	}
+	return nil
+}
+
+func checkRange(field reflect.Value, tag reflect.StructTag) error {
+	if field.Kind() != reflect.Int {
+		return nil
+	}
+
+	v := field.Int()
+	if min, ok := tag.Lookup("min"); ok {
+		if limit, err := strconv.ParseInt(min, 10, 64); err == nil && v < limit {
+			return fmt.Errorf("must be at least %d", limit)
+		}
+	}
+	if max, ok := tag.Lookup("max"); ok {
+		if limit, err := strconv.ParseInt(max, 10, 64); err == nil && v > limit {
+			return fmt.Errorf("must be at most %d", limit)
+		}
+	}
+	return nil
+}
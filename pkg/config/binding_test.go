@@ -0,0 +1,214 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Name     string        `key:"TEST_NAME" required:"true"`
+	Count    int           `key:"TEST_COUNT" default:"2" min:"1" max:"10"`
+	Enabled  bool          `key:"TEST_ENABLED" default:"false"`
+	Timeout  time.Duration `key:"TEST_TIMEOUT" default:"30s"`
+	Password string        `key:"TEST_PASSWORD" secret:"true"`
+	Hosts    []string      `key:"TEST_HOSTS"`
+}
+
+func TestBind(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]string
+		want    testConfig
+		wantErr []string
+	}{
+		{
+			name:   "defaults",
+			values: map[string]string{"TEST_NAME": "scaler"},
+			want:   testConfig{Name: "scaler", Count: 2, Timeout: 30 * time.Second},
+		},
+		{
+			name: "all set",
+			values: map[string]string{
+				"TEST_NAME":     "scaler",
+				"TEST_COUNT":    " 10 ",
+				"TEST_ENABLED":  "true",
+				"TEST_TIMEOUT":  "1m30s",
+				"TEST_PASSWORD": "hunter2",
+				"TEST_HOSTS":    "a, b,,c",
+			},
+			want: testConfig{
+				Name:     "scaler",
+				Count:    10,
+				Enabled:  true,
+				Timeout:  90 * time.Second,
+				Password: "hunter2",
+				Hosts:    []string{"a", "b", "c"},
+			},
+		},
+		{
+			name:    "missing required",
+			values:  map[string]string{},
+			wantErr: []string{"TEST_NAME is required"},
+		},
+		{
+			name:    "below min",
+			values:  map[string]string{"TEST_NAME": "scaler", "TEST_COUNT": "0"},
+			wantErr: []string{`invalid TEST_COUNT value "0" from test: must be at least 1`},
+		},
+		{
+			name:    "above max",
+			values:  map[string]string{"TEST_NAME": "scaler", "TEST_COUNT": "11"},
+			wantErr: []string{`invalid TEST_COUNT value "11" from test: must be at most 10`},
+		},
+		{
+			name:    "bad int",
+			values:  map[string]string{"TEST_NAME": "scaler", "TEST_COUNT": "four"},
+			wantErr: []string{`invalid TEST_COUNT value "four" from test: not an integer`},
+		},
+		{
+			name:    "bad bool",
+			values:  map[string]string{"TEST_NAME": "scaler", "TEST_ENABLED": "enabled"},
+			wantErr: []string{`invalid TEST_ENABLED value "enabled" from test: not a boolean`},
+		},
+		{
+			name:    "bad duration",
+			values:  map[string]string{"TEST_NAME": "scaler", "TEST_TIMEOUT": "30"},
+			wantErr: []string{`invalid TEST_TIMEOUT value "30" from test: not a duration`},
+		},
+		{
+			name:   "all errors together",
+			values: map[string]string{"TEST_COUNT": "four", "TEST_ENABLED": "enabled"},
+			wantErr: []string{
+				"TEST_NAME is required",
+				`invalid TEST_COUNT value "four"`,
+				`invalid TEST_ENABLED value "enabled"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testConfig
+			_, err := Bind(&got, &MapSource{SourceName: "test", Values: tt.values})
+
+			if len(tt.wantErr) > 0 {
+				if err == nil {
+					t.Fatal("Bind() succeeded, want an error")
+				}
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("Bind() error = %q, want it to contain %q", err, want)
+					}
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Bind() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Bind() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "scaler:\n  SCALER_JOB_INTERVAL: 120\n  SCALER_VM_RUNTIME: 600\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	file, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	t.Setenv("SCALER_POOL_CAPACITY", "6")
+	t.Setenv("SCALER_JOB_INTERVAL", "90")
+	t.Setenv("SCALER_VM_RUNTIME", "300")
+	t.Setenv("SCALER_JOB_TIMEOUT", "")
+
+	appConfig := &MapSource{
+		SourceName: "appconfig",
+		Values:     map[string]string{"SCALER_VM_RUNTIME": "900"},
+	}
+
+	var got ScalerConfig
+	report, err := Bind(&got, EnvSource{}, file["scaler"], appConfig)
+	if err != nil {
+		t.Fatalf("Bind() error = %v", err)
+	}
+
+	sources := make(map[string]Binding)
+	for _, b := range report {
+		sources[b.Key] = b
+	}
+
+	tests := []struct {
+		key    string
+		value  int
+		got    int
+		source string
+	}{
+		{key: "SCALER_POOL_CAPACITY", value: 6, got: got.PoolCapacity, source: "env"},
+		{key: "SCALER_JOB_INTERVAL", value: 120, got: got.JobInterval, source: "file"},
+		{key: "SCALER_VM_RUNTIME", value: 900, got: got.VMRuntime, source: "appconfig"},
+		{key: "SCALER_JOB_TIMEOUT", value: 180, got: got.JobTimeout, source: "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if tt.got != tt.value {
+				t.Errorf("%s = %d, want %d", tt.key, tt.got, tt.value)
+			}
+			if sources[tt.key].Source != tt.source {
+				t.Errorf("%s source = %q, want %q", tt.key, sources[tt.key].Source, tt.source)
+			}
+		})
+	}
+}
+
+func TestBindRedactsSecrets(t *testing.T) {
+	var got testConfig
+	report, err := Bind(&got, &MapSource{
+		SourceName: "test",
+		Values:     map[string]string{"TEST_NAME": "scaler", "TEST_PASSWORD": "hunter2"},
+	})
+	if err != nil {
+		t.Fatalf("Bind() error = %v", err)
+	}
+
+	if got.Password != "hunter2" {
+		t.Errorf("Password = %q, want the secret to be bound", got.Password)
+	}
+	for _, b := range report {
+		if b.Key == "TEST_PASSWORD" && b.Value != "***" {
+			t.Errorf("report value of TEST_PASSWORD = %q, want ***", b.Value)
+		}
+	}
+
+	var logged strings.Builder
+	slog.New(slog.NewTextHandler(&logged, nil)).Info("config", "config", report)
+	for _, output := range []string{report.String(), logged.String()} {
+		if strings.Contains(output, "hunter2") {
+			t.Errorf("report leaks the secret: %s", output)
+		}
+	}
+
+	// An unset secret is reported as empty rather than masked
+	report, err = Bind(&got, &MapSource{SourceName: "test", Values: map[string]string{"TEST_NAME": "scaler"}})
+	if err != nil {
+		t.Fatalf("Bind() error = %v", err)
+	}
+	for _, b := range report {
+		if b.Key == "TEST_PASSWORD" && b.Value != "" {
+			t.Errorf("report value of unset TEST_PASSWORD = %q, want empty", b.Value)
+		}
+	}
+}
@@ -1,109 +1,195 @@
 package config
 
 import (
-	"os"
-	"strconv"
+	"fmt"
+	"strings"
 )
 
-func getEnvInt(key string, fallback int) int {
-	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
-		return value
+// splitList parses a comma-separated list, ignoring empty entries
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
 	}
-	return fallback
+	return values
+}
+
+// load binds a config section from env and the config file, followed by any extra sources
+func load[T any](section string, extra ...Source) (*T, Report, error) {
+	sources, err := sectionSources(section)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := new(T)
+	report, err := Bind(config, append(sources, extra...)...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid %s config:\n%w", section, err)
+	}
+
+	return config, report, nil
 }
 
 type RedisConfig struct {
-	Host string
-	Port string
-	SSL  bool
+	Host string `key:"REDIS_HOST" required:"true"`
+	Port string `key:"REDIS_PORT" required:"true"`
+	SSL  bool   `key:"REDIS_SSL" default:"false"`
 }
 
 func LoadRedisConfig() (*RedisConfig, error) {
-	config := &RedisConfig{
-		Host: os.Getenv("REDIS_HOST"),
-		Port: os.Getenv("REDIS_PORT"),
-		SSL:  os.Getenv("REDIS_SSL") == "true",
-	}
-
-	return config, nil
+	config, _, err := load[RedisConfig]("redis")
+	return config, err
 }
 
 type VMSSConfig struct {
-	SubscriptionID     string
-	TenantID           string
-	ResourceGroup      string
-	ScaleSetName       string
-	InstrumentationKey string
+	SubscriptionID     string `key:"AZURE_SUBSCRIPTION_ID" required:"true"`
+	TenantID           string `key:"AZURE_TENANT_ID"`
+	ResourceGroup      string `key:"AZURE_RESOURCE_GROUP" required:"true"`
+	ScaleSetName       string `key:"AZURE_VMSS_NAME" required:"true"`
+	InstrumentationKey string `key:"AZURE_APPI_INSTRUMENTATION_KEY" secret:"true"`
 }
 
 func LoadVMSSConfig() (*VMSSConfig, error) {
-	config := &VMSSConfig{
-		SubscriptionID:     os.Getenv("AZURE_SUBSCRIPTION_ID"),
-		TenantID:           os.Getenv("AZURE_TENANT_ID"),
-		ResourceGroup:      os.Getenv("AZURE_RESOURCE_GROUP"),
-		ScaleSetName:       os.Getenv("AZURE_VMSS_NAME"),
-		InstrumentationKey: os.Getenv("AZURE_APPI_INSTRUMENTATION_KEY"),
-	}
-
-	return config, nil
+	config, _, err := load[VMSSConfig]("vmss")
+	return config, err
 }
 
 type ScalerConfig struct {
-	PoolCapacity    int
-	JobInterval     int
-	JobTimeout      int
-	VMRuntime       int
-	JobDelay        int
-	GeoName         string
-	WarmPoolSize    int
-	WarmPoolEnabled bool
+	PoolCapacity      int    `key:"SCALER_POOL_CAPACITY" default:"4" min:"1"`
+	JobInterval       int    `key:"SCALER_JOB_INTERVAL" default:"60" min:"1"`
+	JobTimeout        int    `key:"SCALER_JOB_TIMEOUT" default:"180" min:"1"`
+	VMRuntime         int    `key:"SCALER_VM_RUNTIME" default:"360" min:"1"`
+	JobDelay          int    `key:"SCALER_JOB_DELAY" default:"10" min:"1"`
+	JobJitter         int    `key:"SCALER_JOB_JITTER" default:"0" min:"0"`
+	ShutdownGrace     int    `key:"SCALER_SHUTDOWN_GRACE" default:"30" min:"0"`
+	LeaseTTL          int    `key:"SCALER_LEASE_TTL" default:"15" min:"3"`
+	LockTTL           int    `key:"SCALER_LOCK_TTL" default:"30" min:"1"`
+	WorkerPoolSize    int    `key:"SCALER_WORKER_POOL_SIZE" default:"4" min:"1" max:"64"`
+	InstanceTimeout   int    `key:"SCALER_INSTANCE_TIMEOUT" default:"30" min:"1"`
+	StartMaxRetries   int    `key:"SCALER_START_MAX_RETRIES" default:"3" min:"0"`
+	RetryBackoff      int    `key:"SCALER_RETRY_BACKOFF" default:"10" min:"1"`
+	RetryBackoffMax   int    `key:"SCALER_RETRY_BACKOFF_MAX" default:"300" min:"1"`
+	GeoName           string `key:"SCALER_GEO_NAME"`
+	MetricsAddr       string `key:"SCALER_METRICS_ADDR" default:":9090"`
+	WarmPoolSize      int    `key:"SCALER_WARMPOOL_SIZE" default:"0" min:"0"`
+	WarmPoolEnabled   bool   `key:"SCALER_WARMPOOL_ENABLED" default:"false"`
+	ReadinessPort     int    `key:"SCALER_READINESS_PORT" default:"80" min:"1" max:"65535"`
+	ReadinessPath     string `key:"SCALER_READINESS_PATH" default:"/"`
+	ReadinessInterval int    `key:"SCALER_READINESS_INTERVAL" default:"5" min:"1"`
+	ReadinessTimeout  int    `key:"SCALER_READINESS_TIMEOUT" default:"300" min:"1"`
 }
 
 func LoadScalerConfig() (*ScalerConfig, error) {
-	config := &ScalerConfig{
-		PoolCapacity:    getEnvInt("SCALER_POOL_CAPACITY", 4),
-		JobInterval:     getEnvInt("SCALER_JOB_INTERVAL", 60),
-		JobTimeout:      getEnvInt("SCALER_JOB_TIMEOUT", 180),
-		VMRuntime:       getEnvInt("SCALER_VM_RUNTIME", 360),
-		JobDelay:        getEnvInt("SCALER_JOB_DELAY", 10),
-		GeoName:         os.Getenv("SCALER_GEO_NAME"),
-		WarmPoolSize:    getEnvInt("SCALER_WARMPOOL_SIZE", 0),
-		WarmPoolEnabled: os.Getenv("SCALER_WARMPOOL_ENABLED") == "true",
-	}
+	config, _, err := LoadScalerConfigFrom()
+	return config, err
+}
 
-	return config, nil
+// LoadScalerConfigFrom binds the scaler config from env, the config file and the given
+// sources in increasing precedence
+func LoadScalerConfigFrom(sources ...Source) (*ScalerConfig, Report, error) {
+	return load[ScalerConfig]("scaler", sources...)
 }
 
 type AppGWConfig struct {
-	SubscriptionID string
-	ResourceGroup  string
-	GWName         string
-	PathMapName    string
+	SubscriptionID string       `key:"AZURE_SUBSCRIPTION_ID" required:"true"`
+	ResourceGroup  string       `key:"AZURE_RESOURCE_GROUP" required:"true"`
+	GWName         string       `key:"AZURE_APPGW_NAME"`
+	PathMapName    string       `key:"AZURE_APPGW_PATH_MAP_NAME"`
+	UpdateTimeout  int          `key:"AZURE_APPGW_UPDATE_TIMEOUT" default:"300" min:"1"`
+	RuleNameFormat string       `key:"AZURE_APPGW_RULE_NAME_FORMAT" default:"instance{instanceId}"`
+	Routes         []AppGWRoute `key:"AZURE_APPGW_ROUTES" default:"[{\"paths\":[\"/{vmid}\"],\"httpSettings\":\"wss\"}]"`
+	ProtectedRules []string     `key:"AZURE_APPGW_PROTECTED_RULES" default:"default"`
+}
+
+// AppGWRoute is a path rule template applied to every instance.
+// Name and paths may reference {vmid}, {instanceId} and, in the rule name format, {route}.
+// Routes are given as a JSON array, e.g. [{"name":"-signalling","paths":["/{vmid}/*"],"httpSettings":"wss"}]
+type AppGWRoute struct {
+	Name         string   `json:"name"`
+	Paths        []string `json:"paths"`
+	HTTPSettings string   `json:"httpSettings"`
 }
 
 func LoadAppGWConfig() (*AppGWConfig, error) {
-	config := &AppGWConfig{
-		SubscriptionID: os.Getenv("AZURE_SUBSCRIPTION_ID"),
-		ResourceGroup:  os.Getenv("AZURE_RESOURCE_GROUP"),
-		GWName:         os.Getenv("AZURE_APPGW_NAME"),
-		PathMapName:    os.Getenv("AZURE_APPGW_PATH_MAP_NAME"),
-	}
+	config, _, err := load[AppGWConfig]("appgw")
+	return config, err
+}
+
+type RoutingConfig struct {
+	Backend       string `key:"ROUTING_BACKEND" default:"appgw"`
+	FileFormat    string `key:"ROUTING_FILE_FORMAT" default:"nginx"`
+	FilePath      string `key:"ROUTING_FILE_PATH"`
+	ReloadCommand string `key:"ROUTING_RELOAD_COMMAND"`
+	BackendPort   int    `key:"ROUTING_BACKEND_PORT" default:"80" min:"1" max:"65535"`
+	ListenPort    int    `key:"ROUTING_LISTEN_PORT" default:"8080" min:"1" max:"65535"`
+}
+
+func LoadRoutingConfig() (*RoutingConfig, error) {
+	config, _, err := load[RoutingConfig]("routing")
+	return config, err
+}
+
+type SessionConfig struct {
+	TokenSecret string `key:"SESSION_TOKEN_SECRET" secret:"true"`
+	TokenIssuer string `key:"SESSION_TOKEN_ISSUER" default:"scaler"`
+	TokenTTL    int    `key:"SESSION_TOKEN_TTL" default:"360" min:"1"`
+	VerifyAddr  string `key:"SESSION_VERIFY_ADDR" default:":8080"`
+	TURNSecret  string `key:"SESSION_TURN_SECRET" secret:"true"`
+	// TrustedProxies is the number of proxies appending to X-Forwarded-For in front of the verifier
+	TrustedProxies int `key:"SESSION_TRUSTED_PROXIES" default:"1" min:"0"`
+	// TrustedProxyCIDRs are the peers whose forwarding headers are honoured
+	TrustedProxyCIDRs []string `key:"SESSION_TRUSTED_PROXY_CIDRS" default:"10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,127.0.0.0/8"`
+}
 
-	return config, nil
+func LoadSessionConfig() (*SessionConfig, error) {
+	config, _, err := load[SessionConfig]("session")
+	return config, err
 }
 
 type AppConfigConfig struct {
-	SubscriptionID string
-	ResourceGroup  string
-	StoreName      string
+	Provider        string   `key:"APPCONFIG_PROVIDER" default:"azure"`
+	FilePath        string   `key:"APPCONFIG_FILE"`
+	SubscriptionID  string   `key:"AZURE_SUBSCRIPTION_ID"`
+	ResourceGroup   string   `key:"AZURE_RESOURCE_GROUP"`
+	StoreName       string   `key:"AZURE_CONFIG_NAME"`
+	SentinelKey     string   `key:"AZURE_CONFIG_SENTINEL_KEY" default:"SCALER_SENTINEL"`
+	RefreshInterval int      `key:"AZURE_CONFIG_REFRESH_INTERVAL" default:"30" min:"1"`
+	Labels          []string `key:"AZURE_CONFIG_LABELS"`
 }
 
 func LoadAppConfigConfig() (*AppConfigConfig, error) {
-	config := &AppConfigConfig{
-		SubscriptionID: os.Getenv("AZURE_SUBSCRIPTION_ID"),
-		ResourceGroup:  os.Getenv("AZURE_RESOURCE_GROUP"),
-		StoreName:      os.Getenv("AZURE_CONFIG_NAME"),
-	}
+	config, _, err := load[AppConfigConfig]("appconfig")
+	return config, err
+}
+
+type TracingConfig struct {
+	Exporter      string `key:"TRACING_EXPORTER" default:"none"`
+	Endpoint      string `key:"TRACING_OTLP_ENDPOINT"`
+	SamplePercent int    `key:"TRACING_SAMPLE_PERCENT" default:"100" min:"0" max:"100"`
+}
+
+func LoadTracingConfig() (*TracingConfig, error) {
+	config, _, err := load[TracingConfig]("tracing")
+	return config, err
+}
+
+type TelemetryConfig struct {
+	Sinks []string `key:"TELEMETRY_SINKS" default:"appinsights"`
+}
+
+func LoadTelemetryConfig() (*TelemetryConfig, error) {
+	config, _, err := load[TelemetryConfig]("telemetry")
+	return config, err
+}
+
+type LoggingConfig struct {
+	Level  string `key:"LOG_LEVEL" default:"info"`
+	Format string `key:"LOG_FORMAT" default:"json"`
+}
 
-	return config, nil
+func LoadLoggingConfig() (*LoggingConfig, error) {
+	config, _, err := load[LoggingConfig]("logging")
+	return config, err
 }
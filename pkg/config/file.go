@@ -0,0 +1,160 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the env var holding the path of the optional YAML or JSON config file
+const ConfigFileEnv = "SCALER_CONFIG_FILE"
+
+// sections maps the top-level keys of the config file to the configs they populate.
+// Each section holds the same keys as the env vars, e.g.
+//
+//	redis:
+//	  REDIS_HOST: cache.redis.cache.windows.net
+//	  REDIS_PORT: "6380"
+var sections = map[string]reflect.Type{
+	"redis":     reflect.TypeOf(RedisConfig{}),
+	"vmss":      reflect.TypeOf(VMSSConfig{}),
+	"scaler":    reflect.TypeOf(ScalerConfig{}),
+	"appgw":     reflect.TypeOf(AppGWConfig{}),
+	"routing":   reflect.TypeOf(RoutingConfig{}),
+	"session":   reflect.TypeOf(SessionConfig{}),
+	"appconfig": reflect.TypeOf(AppConfigConfig{}),
+	"tracing":   reflect.TypeOf(TracingConfig{}),
+	"telemetry": reflect.TypeOf(TelemetryConfig{}),
+	"logging":   reflect.TypeOf(LoggingConfig{}),
+}
+
+var (
+	fileOnce     sync.Once
+	fileSections map[string]*MapSource
+	fileErr      error
+)
+
+// sectionSources returns the sources of a config section: env vars, then the config file if any
+func sectionSources(section string) ([]Source, error) {
+	fileOnce.Do(func() {
+		if path := os.Getenv(ConfigFileEnv); path != "" {
+			fileSections, fileErr = LoadFile(path)
+		}
+	})
+	if fileErr != nil {
+		return nil, fileErr
+	}
+
+	sources := []Source{EnvSource{}}
+	if source, ok := fileSections[section]; ok {
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// LoadFile parses a YAML or JSON config file into one source per section.
+// Unknown sections and keys are rejected so typos do not silently fall back to defaults.
+func LoadFile(path string) (map[string]*MapSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var raw map[string]map[string]any
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	var errs []error
+	result := make(map[string]*MapSource, len(raw))
+
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		// Extension sections only hold anchors shared by other sections
+		if strings.HasPrefix(name, "x-") {
+			continue
+		}
+
+		configType, ok := sections[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown section %q", name))
+			continue
+		}
+
+		known := make(map[string]bool)
+		for i := 0; i < configType.NumField(); i++ {
+			if key := configType.Field(i).Tag.Get("key"); key != "" {
+				known[key] = true
+			}
+		}
+
+		source := &MapSource{
+			SourceName: "file",
+			Values:     make(map[string]string, len(raw[name])),
+		}
+		for key, value := range raw[name] {
+			if !known[key] {
+				errs = append(errs, fmt.Errorf("unknown key %q in section %q", key, name))
+				continue
+			}
+
+			str, err := stringValue(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid value of %q in section %q: %w", key, name, err))
+				continue
+			}
+			source.Values[key] = str
+		}
+		result[name] = source
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid config file %s:\n%w", path, errors.Join(errs...))
+	}
+	return result, nil
+}
+
+// stringValue converts a decoded value to the string form Bind parses:
+// scalars as text, lists of scalars comma-separated and anything else as JSON
+func stringValue(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]any, []any:
+				data, err := json.Marshal(v)
+				return string(data), err
+			}
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ","), nil
+	case map[string]any:
+		data, err := json.Marshal(v)
+		return string(data), err
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
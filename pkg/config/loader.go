@@ -0,0 +1,98 @@
+package config
+
+import (
+	"errors"
+)
+
+// Loader loads the config sections of a job and collects their errors, so an operator sees
+// every missing or invalid setting at once instead of one per restart.
+// The configs it returns are nil for invalid sections and must not be used before Err is checked.
+type Loader struct {
+	errs []error
+}
+
+// Add records an error of a step that belongs to loading the configuration
+func (l *Loader) Add(err error) {
+	if err == nil {
+		return
+	}
+	// A broken config file fails every section with the same error
+	for _, existing := range l.errs {
+		if existing == err {
+			return
+		}
+	}
+	l.errs = append(l.errs, err)
+}
+
+// Err returns all collected errors, or nil when every section is valid
+func (l *Loader) Err() error {
+	return errors.Join(l.errs...)
+}
+
+func (l *Loader) Redis() *RedisConfig {
+	config, err := LoadRedisConfig()
+	l.Add(err)
+	return config
+}
+
+func (l *Loader) VMSS() *VMSSConfig {
+	config, err := LoadVMSSConfig()
+	l.Add(err)
+	return config
+}
+
+func (l *Loader) Scaler() *ScalerConfig {
+	config, err := LoadScalerConfig()
+	l.Add(err)
+	return config
+}
+
+// ScalerFrom loads the scaler config with the given sources taking precedence, see LoadScalerConfigFrom
+func (l *Loader) ScalerFrom(sources ...Source) (*ScalerConfig, Report) {
+	config, report, err := LoadScalerConfigFrom(sources...)
+	l.Add(err)
+	return config, report
+}
+
+func (l *Loader) AppGW() *AppGWConfig {
+	config, err := LoadAppGWConfig()
+	l.Add(err)
+	return config
+}
+
+func (l *Loader) Routing() *RoutingConfig {
+	config, err := LoadRoutingConfig()
+	l.Add(err)
+	return config
+}
+
+func (l *Loader) Session() *SessionConfig {
+	config, err := LoadSessionConfig()
+	l.Add(err)
+	return config
+}
+
+func (l *Loader) AppConfig() *AppConfigConfig {
+	config, err := LoadAppConfigConfig()
+	l.Add(err)
+	return config
+}
+
+func (l *Loader) Tracing() *TracingConfig {
+	config, err := LoadTracingConfig()
+	l.Add(err)
+	return config
+}
+
+func (l *Loader) Telemetry() *TelemetryConfig {
+	config, err := LoadTelemetryConfig()
+	l.Add(err)
+	return config
+}
+
+func (l *Loader) Logging() *LoggingConfig {
+	config, err := LoadLoggingConfig()
+	l.Add(err)
+	return config
+}
@@ -0,0 +1,212 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"scaler/pkg/logging"
+	"scaler/pkg/redis"
+)
+
+// releaseTimeout bounds giving the lease up on shutdown
+const releaseTimeout = 5 * time.Second
+
+// Elector campaigns for a Redis lease so only one replica of a job performs mutations
+type Elector struct {
+	redis   redis.Client
+	key     string
+	owner   string
+	ttl     time.Duration
+	cancel  context.CancelFunc
+	done    chan struct{}
+	mu      sync.Mutex
+	leading bool
+	token   int64
+	expiry  time.Time
+	term    context.Context
+	endTerm context.CancelFunc
+	// deadline ends the term when the lease expires without a renewal
+	deadline *time.Timer
+}
+
+func NewElector(redisClient redis.Client, job string, ttl time.Duration) (*Elector, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invalid lease TTL: %v, must be positive", ttl)
+	}
+
+	return &Elector{
+		redis: redisClient,
+		key:   fmt.Sprintf("vmss:leader:%s", job),
+		owner: redis.NewOwnerID(job),
+		ttl:   ttl,
+		done:  make(chan struct{}),
+	}, nil
+}
+
+func (e *Elector) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+
+	slog.Info("Campaigning for leadership", "lease", e.key, "owner", e.owner)
+
+	go func() {
+		defer close(e.done)
+
+		// Renew well within the TTL so a single missed round does not lose the lease
+		ticker := time.NewTicker(e.ttl / 3)
+		defer ticker.Stop()
+
+		for {
+			e.campaign(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop ends the campaign and releases the lease so a standby can take over immediately
+func (e *Elector) Stop() error {
+	if e.cancel == nil {
+		return nil
+	}
+	e.cancel()
+	<-e.done
+
+	e.mu.Lock()
+	leading := e.leading
+	e.lose()
+	e.mu.Unlock()
+
+	if !leading {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	if err := e.redis.ReleaseLease(ctx, e.key, e.owner); err != nil {
+		return err
+	}
+	slog.Info("Released leadership", "lease", e.key)
+	return nil
+}
+
+// IsLeader reports whether this replica holds an unexpired lease
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leading && time.Now().Before(e.expiry)
+}
+
+// Lead returns a context cancelled when leadership is lost, or false when not leading
+func (e *Elector) Lead(ctx context.Context) (context.Context, context.CancelFunc, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.leading || !time.Now().Before(e.expiry) {
+		return ctx, func() {}, false
+	}
+
+	// Redis writes made in the term are fenced by its token
+	ctx, cancel := context.WithCancel(redis.WithFence(ctx, e.key, e.token))
+	stop := context.AfterFunc(e.term, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}, true
+}
+
+// Token returns the fencing token of the leadership term the context was started in
+func Token(ctx context.Context) int64 {
+	return redis.FenceToken(ctx)
+}
+
+func (e *Elector) campaign(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, e.ttl/3)
+	defer cancel()
+
+	e.mu.Lock()
+	leading := e.leading
+	e.mu.Unlock()
+
+	// Local expiry is measured from before the call so it never outlives the Redis TTL
+	renewedAt := time.Now()
+
+	if leading {
+		renewed, err := e.redis.RenewLease(ctx, e.key, e.owner, e.ttl)
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		// The term already ended at the lease deadline while renewing
+		if !e.leading {
+			return
+		}
+
+		switch {
+		case err != nil && time.Now().Before(e.expiry):
+			slog.Warn("Failed to renew leadership, retrying", "lease", e.key, logging.Err(err))
+		case err != nil || !renewed:
+			slog.Warn("Lost leadership", "lease", e.key, "token", e.token)
+			e.lose()
+		default:
+			e.expiry = renewedAt.Add(e.ttl)
+			e.deadline.Reset(time.Until(e.expiry))
+		}
+		return
+	}
+
+	token, err := e.redis.AcquireLease(ctx, e.key, e.owner, e.ttl)
+	if err != nil {
+		slog.Warn("Failed to campaign for leadership", "lease", e.key, logging.Err(err))
+		return
+	}
+	if token == 0 {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.leading = true
+	e.token = token
+	e.expiry = renewedAt.Add(e.ttl)
+	e.term, e.endTerm = context.WithCancel(context.Background())
+	e.deadline = time.AfterFunc(time.Until(e.expiry), e.expire)
+
+	slog.Info("Acquired leadership", "lease", e.key, "owner", e.owner, "token", token)
+}
+
+// expire ends the term at the lease deadline, unless the lease was renewed meanwhile
+func (e *Elector) expire() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.leading || time.Now().Before(e.expiry) {
+		return
+	}
+	slog.Warn("Leadership lease expired before renewal", "lease", e.key, "token", e.token)
+	e.lose()
+}
+
+// lose ends the current term, callers must hold the mutex
+func (e *Elector) lose() {
+	e.leading = false
+	if e.deadline != nil {
+		e.deadline.Stop()
+		e.deadline = nil
+	}
+	if e.endTerm != nil {
+		e.endTerm()
+		e.endTerm = nil
+	}
+}
@@ -0,0 +1,90 @@
+package leader
+
+import (
+	"context"
+
+	"scaler/internal/vmss"
+	"scaler/pkg/redis"
+	"scaler/pkg/routing"
+)
+
+// Redis writes are fenced atomically by the Redis client. Azure calls cannot be, so the
+// wrappers below check the fence right before every mutation: a deposed leader resuming
+// after a pause fails there instead of acting on a pool now owned by another replica.
+
+// fencedProvider checks the leadership fence before VMSS mutations
+type fencedProvider struct {
+	vmss.Provider
+	redis redis.Client
+}
+
+// FenceVMSS wraps a VMSS provider so mutations fail with redis.ErrFenced after leadership is lost
+func FenceVMSS(provider vmss.Provider, redisClient redis.Client) vmss.Provider {
+	return &fencedProvider{
+		Provider: provider,
+		redis:    redisClient,
+	}
+}
+
+func (p *fencedProvider) CreateInstances(ctx context.Context, desiredCount int64) error {
+	if err := p.redis.CheckFence(ctx); err != nil {
+		return err
+	}
+	return p.Provider.CreateInstances(ctx, desiredCount)
+}
+
+func (p *fencedProvider) StartInstance(ctx context.Context, instanceID string) error {
+	if err := p.redis.CheckFence(ctx); err != nil {
+		return err
+	}
+	return p.Provider.StartInstance(ctx, instanceID)
+}
+
+func (p *fencedProvider) StopInstance(ctx context.Context, instanceID string) error {
+	if err := p.redis.CheckFence(ctx); err != nil {
+		return err
+	}
+	return p.Provider.StopInstance(ctx, instanceID)
+}
+
+func (p *fencedProvider) DeleteInstance(ctx context.Context, instanceID string) error {
+	if err := p.redis.CheckFence(ctx); err != nil {
+		return err
+	}
+	return p.Provider.DeleteInstance(ctx, instanceID)
+}
+
+// fencedRouter checks the leadership fence before routing changes
+type fencedRouter struct {
+	router routing.Router
+	redis  redis.Client
+}
+
+// FenceRouter wraps a router so changes fail with redis.ErrFenced after leadership is lost
+func FenceRouter(router routing.Router, redisClient redis.Client) routing.Router {
+	return &fencedRouter{
+		router: router,
+		redis:  redisClient,
+	}
+}
+
+func (r *fencedRouter) RegisterInstance(ctx context.Context, instance *vmss.VMInstance) error {
+	if err := r.redis.CheckFence(ctx); err != nil {
+		return err
+	}
+	return r.router.RegisterInstance(ctx, instance)
+}
+
+func (r *fencedRouter) DeregisterInstance(ctx context.Context, instance *vmss.VMInstance) error {
+	if err := r.redis.CheckFence(ctx); err != nil {
+		return err
+	}
+	return r.router.DeregisterInstance(ctx, instance)
+}
+
+func (r *fencedRouter) Sync(ctx context.Context, instances []*vmss.VMInstance) error {
+	if err := r.redis.CheckFence(ctx); err != nil {
+		return err
+	}
+	return r.router.Sync(ctx, instances)
+}
@@ -0,0 +1,157 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"scaler/internal/vmss"
+	"scaler/pkg/config"
+	"scaler/pkg/logkey"
+
+	"github.com/google/uuid"
+)
+
+// Correlation fields shared by all services, defined in logkey for packages logging depends on
+const (
+	KeyService    = logkey.Service
+	KeyJob        = logkey.Job
+	KeyRunID      = logkey.RunID
+	KeyInstanceID = logkey.InstanceID
+	KeyVMID       = logkey.VMID
+	KeySessionID  = logkey.SessionID
+	KeyRegion     = logkey.Region
+	KeyOperation  = logkey.Operation
+	KeyDuration   = logkey.Duration
+	KeyError      = logkey.Error
+)
+
+type attrsKey struct{}
+
+// Setup installs the default slog logger for a service, the standard log package writes through it too
+func Setup(cfg *config.LoggingConfig, service string) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	case "text":
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	default:
+		return fmt.Errorf("unsupported log format: %s", cfg.Format)
+	}
+
+	logger := slog.New(&contextHandler{handler: handler}).With(KeyService, service)
+	slog.SetDefault(logger)
+	return nil
+}
+
+// Fatal logs at error level and exits, the structured counterpart of log.Fatal
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// With returns a context whose log records carry the given key/value pairs
+func With(ctx context.Context, args ...any) context.Context {
+	existing, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+
+	record := slog.Record{}
+	record.Add(args...)
+
+	attrs := make([]slog.Attr, 0, len(existing)+record.NumAttrs())
+	attrs = append(attrs, existing...)
+	record.Attrs(func(attr slog.Attr) bool {
+		// Later values replace earlier ones of the same key
+		for i := range attrs {
+			if attrs[i].Key == attr.Key {
+				attrs[i] = attr
+				return true
+			}
+		}
+		attrs = append(attrs, attr)
+		return true
+	})
+
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+// WithRecord adds the identifiers of an instance record to the context
+func WithRecord(ctx context.Context, record *vmss.VMRedisRecord) context.Context {
+	args := []any{KeyInstanceID, record.InstanceID, KeyVMID, record.VMID}
+	if record.SessionID != "" {
+		args = append(args, KeySessionID, record.SessionID)
+	}
+	if record.Region != "" {
+		args = append(args, KeyRegion, record.Region)
+	}
+	return With(ctx, args...)
+}
+
+// WithRun starts the correlation fields of a job run
+func WithRun(ctx context.Context, job string) context.Context {
+	return With(ctx, KeyJob, job, KeyRunID, uuid.NewString())
+}
+
+// RunID returns the run ID carried by the context, if any
+func RunID(ctx context.Context) string {
+	return value(ctx, KeyRunID)
+}
+
+// Job returns the job name carried by the context, if any
+func Job(ctx context.Context) string {
+	return value(ctx, KeyJob)
+}
+
+func value(ctx context.Context, key string) string {
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	for _, attr := range attrs {
+		if attr.Key == key {
+			return attr.Value.String()
+		}
+	}
+	return ""
+}
+
+// Duration is the duration field in milliseconds
+func Duration(d time.Duration) slog.Attr {
+	return slog.Int64(KeyDuration, d.Milliseconds())
+}
+
+// Err is the error field
+func Err(err error) slog.Attr {
+	return logkey.Err(err)
+}
+
+// contextHandler adds the correlation fields carried by the context to every record
+type contextHandler struct {
+	handler slog.Handler
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		record.AddAttrs(attrs...)
+	}
+	return h.handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{handler: h.handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{handler: h.handler.WithGroup(name)}
+}
@@ -0,0 +1,27 @@
+// Package logkey names the structured log fields shared by all services. It has no dependencies
+// so that packages logging itself depends on, like internal/vmss, can use the same fields.
+package logkey
+
+import "log/slog"
+
+// Correlation fields shared by all services
+const (
+	Service    = "service"
+	Job        = "job"
+	RunID      = "runId"
+	InstanceID = "instanceId"
+	VMID       = "vmId"
+	SessionID  = "sessionId"
+	Region     = "region"
+	Operation  = "operation"
+	Duration   = "durationMs"
+	Error      = "error"
+)
+
+// Err is the error field
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.Attr{}
+	}
+	return slog.String(Error, err.Error())
+}
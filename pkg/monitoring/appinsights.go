@@ -0,0 +1,128 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights"
+)
+
+// appInsightsCloseTimeout bounds how long Close retries failed transmissions
+const appInsightsCloseTimeout = 10 * time.Second
+
+// AppInsightsSink sends operation events to Application Insights as custom events
+type AppInsightsSink struct {
+	client appinsights.TelemetryClient
+}
+
+func NewAppInsightsSink(instrumentationKey string) (*AppInsightsSink, error) {
+	// Validate mandatory parameters
+	if instrumentationKey == "" {
+		return nil, fmt.Errorf("application insights instrumentation key is required")
+	}
+
+	telemetryConfig := appinsights.NewTelemetryConfiguration(instrumentationKey)
+
+	// Configure the client
+	telemetryConfig.MaxBatchSize = 1024
+	telemetryConfig.MaxBatchInterval = time.Second * 2
+
+	client := appinsights.NewTelemetryClientFromConfig(telemetryConfig)
+
+	// Send initial telemetry to verify connection
+	startupEvent := appinsights.NewEventTelemetry("MonitorStartup")
+	startupEvent.Properties["timestamp"] = time.Now().UTC().Format(time.RFC3339)
+	client.Track(startupEvent)
+
+	slog.Info("Initialized Application Insights (data may take 2-5 minutes to appear)")
+
+	return &AppInsightsSink{
+		client: client,
+	}, nil
+}
+
+func (s *AppInsightsSink) Track(ctx context.Context, event OperationEvent) {
+	// Custom event for Log Analytics querying
+	telemetry := appinsights.NewEventTelemetry("VMSSOperation")
+	telemetry.Timestamp = event.Timestamp
+
+	telemetry.Properties["operationId"] = event.OperationID
+	telemetry.Properties["operation"] = event.Operation
+	telemetry.Properties["resourceId"] = event.ResourceID
+	telemetry.Properties["region"] = event.Region
+	telemetry.Properties["duration"] = fmt.Sprintf("%d", int(event.Duration.Seconds()))
+	telemetry.Properties["durationMs"] = fmt.Sprintf("%d", event.Duration.Milliseconds())
+	telemetry.Properties["success"] = fmt.Sprintf("%t", event.Success)
+	if event.ErrorMessage != "" {
+		telemetry.Properties["error"] = event.ErrorMessage
+		telemetry.Properties["errorClass"] = event.ErrorClass
+	}
+	if event.TraceID != "" {
+		telemetry.Properties["traceId"] = event.TraceID
+	}
+	if event.RunID != "" {
+		telemetry.Properties["job"] = event.Job
+		telemetry.Properties["runId"] = event.RunID
+	}
+
+	s.client.Track(telemetry)
+
+	if event.Success {
+		return
+	}
+
+	// Failures are also reported as exceptions so they show up under Failures
+	var exception *appinsights.ExceptionTelemetry
+	if event.Err != nil {
+		exception = appinsights.NewExceptionTelemetry(event.Err)
+	} else {
+		exception = appinsights.NewExceptionTelemetry(event.ErrorMessage)
+	}
+	exception.Timestamp = event.Timestamp
+	exception.Properties["operationId"] = event.OperationID
+	exception.Properties["operation"] = event.Operation
+	exception.Properties["resourceId"] = event.ResourceID
+	exception.Properties["region"] = event.Region
+	exception.Properties["errorClass"] = event.ErrorClass
+	if event.TraceID != "" {
+		exception.Properties["traceId"] = event.TraceID
+	}
+	if event.RunID != "" {
+		exception.Properties["job"] = event.Job
+		exception.Properties["runId"] = event.RunID
+	}
+
+	s.client.Track(exception)
+}
+
+func (s *AppInsightsSink) TrackDependency(ctx context.Context, event DependencyEvent) {
+	telemetry := appinsights.NewRemoteDependencyTelemetry(event.Name, event.Type, event.Target, event.Success)
+	telemetry.Timestamp = event.Timestamp
+	telemetry.Duration = event.Duration
+
+	if !event.Success {
+		telemetry.ResultCode = event.ErrorClass
+		telemetry.Properties["error"] = event.ErrorMessage
+		telemetry.Properties["errorClass"] = event.ErrorClass
+	}
+	if event.TraceID != "" {
+		telemetry.Properties["traceId"] = event.TraceID
+	}
+	if event.RunID != "" {
+		telemetry.Properties["job"] = event.Job
+		telemetry.Properties["runId"] = event.RunID
+	}
+
+	s.client.Track(telemetry)
+}
+
+func (s *AppInsightsSink) Close(ctx context.Context) error {
+	select {
+	case <-s.client.Channel().Close(appInsightsCloseTimeout):
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to flush application insights telemetry: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,110 @@
+package monitoring
+
+import (
+	"context"
+	"time"
+
+	"scaler/internal/vmss"
+	"scaler/pkg/logging"
+	"scaler/pkg/redis"
+)
+
+// Dependency types reported to the sinks
+const (
+	DependencyARM   = "Azure Resource Manager"
+	DependencyRedis = "Redis"
+)
+
+// Dependency is a single call to an external service
+type Dependency struct {
+	Type     string
+	Target   string
+	Name     string
+	Duration time.Duration
+	Err      error
+}
+
+// RedisObserver reports the Redis commands of job runs as dependencies of target. Commands
+// outside a run, such as metrics scrapes and event subscriptions, are only noise in telemetry.
+func RedisObserver(monitor Monitor, target string) redis.CommandObserver {
+	return func(ctx context.Context, command string, duration time.Duration, err error) {
+		if logging.RunID(ctx) == "" {
+			return
+		}
+		monitor.TrackDependency(ctx, Dependency{
+			Type:     DependencyRedis,
+			Target:   target,
+			Name:     command,
+			Duration: duration,
+			Err:      err,
+		})
+	}
+}
+
+// instrumentedProvider reports the ARM calls of a VMSS provider as dependencies
+type instrumentedProvider struct {
+	provider vmss.Provider
+	monitor  Monitor
+	target   string
+}
+
+// InstrumentVMSS wraps a VMSS provider so every call is tracked as a dependency of target
+func InstrumentVMSS(provider vmss.Provider, monitor Monitor, target string) vmss.Provider {
+	return &instrumentedProvider{
+		provider: provider,
+		monitor:  monitor,
+		target:   target,
+	}
+}
+
+func (p *instrumentedProvider) track(ctx context.Context, name string, start time.Time, err error) {
+	p.monitor.TrackDependency(ctx, Dependency{
+		Type:     DependencyARM,
+		Target:   p.target,
+		Name:     name,
+		Duration: time.Since(start),
+		Err:      err,
+	})
+}
+
+func (p *instrumentedProvider) CreateInstances(ctx context.Context, desiredCount int64) error {
+	start := time.Now()
+	err := p.provider.CreateInstances(ctx, desiredCount)
+	p.track(ctx, "CreateInstances", start, err)
+	return err
+}
+
+func (p *instrumentedProvider) StartInstance(ctx context.Context, instanceID string) error {
+	start := time.Now()
+	err := p.provider.StartInstance(ctx, instanceID)
+	p.track(ctx, "StartInstance", start, err)
+	return err
+}
+
+func (p *instrumentedProvider) StopInstance(ctx context.Context, instanceID string) error {
+	start := time.Now()
+	err := p.provider.StopInstance(ctx, instanceID)
+	p.track(ctx, "StopInstance", start, err)
+	return err
+}
+
+func (p *instrumentedProvider) DeleteInstance(ctx context.Context, instanceID string) error {
+	start := time.Now()
+	err := p.provider.DeleteInstance(ctx, instanceID)
+	p.track(ctx, "DeleteInstance", start, err)
+	return err
+}
+
+func (p *instrumentedProvider) GetInstance(ctx context.Context, instanceID string) (*vmss.VMInstance, error) {
+	start := time.Now()
+	instance, err := p.provider.GetInstance(ctx, instanceID)
+	p.track(ctx, "GetInstance", start, err)
+	return instance, err
+}
+
+func (p *instrumentedProvider) ListInstances(ctx context.Context, opts vmss.ListInstancesOptions) ([]*vmss.VMInstance, error) {
+	start := time.Now()
+	instances, err := p.provider.ListInstances(ctx, opts)
+	p.track(ctx, "ListInstances", start, err)
+	return instances, err
+}
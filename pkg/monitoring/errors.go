@@ -0,0 +1,67 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// Error classes reported with failed operations and dependencies
+const (
+	ErrorClassThrottled     = "throttled"
+	ErrorClassQuotaExceeded = "quota_exceeded"
+	ErrorClassNotFound      = "not_found"
+	ErrorClassTimeout       = "timeout"
+	ErrorClassConflict      = "conflict"
+	ErrorClassUnknown       = "unknown"
+)
+
+// quotaErrorCodes are the ARM error codes returned when a subscription or region runs out of capacity
+var quotaErrorCodes = []string{
+	"QuotaExceeded",
+	"OperationNotAllowed",
+	"SkuNotAvailable",
+	"AllocationFailed",
+	"ZonalAllocationFailed",
+}
+
+// Classify maps an error to one of the error classes, nil errors have no class
+func Classify(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		for _, code := range quotaErrorCodes {
+			if strings.EqualFold(respErr.ErrorCode, code) {
+				return ErrorClassQuotaExceeded
+			}
+		}
+
+		switch respErr.StatusCode {
+		case http.StatusTooManyRequests:
+			return ErrorClassThrottled
+		case http.StatusNotFound:
+			return ErrorClassNotFound
+		case http.StatusConflict, http.StatusPreconditionFailed:
+			return ErrorClassConflict
+		case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+			return ErrorClassTimeout
+		}
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorClassTimeout
+	}
+
+	return ErrorClassUnknown
+}
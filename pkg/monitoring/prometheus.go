@@ -0,0 +1,210 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"scaler/internal/vmss"
+	"scaler/pkg/logging"
+	"scaler/pkg/redis"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// collectTimeout bounds the Redis reads made while serving a scrape
+const collectTimeout = 5 * time.Second
+
+var (
+	operationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scaler_operations_total",
+		Help: "VMSS operations by type and outcome.",
+	}, []string{"operation", "outcome"})
+
+	operationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scaler_operation_duration_seconds",
+		Help:    "Latency of VMSS operations such as provision, start and clean.",
+		Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200},
+	}, []string{"operation", "outcome"})
+
+	operationFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scaler_operation_failures_total",
+		Help: "Failed VMSS operations by type and error class.",
+	}, []string{"operation", "error_class"})
+
+	dependencyDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scaler_dependency_duration_seconds",
+		Help:    "Latency of ARM and Redis calls.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"type", "name", "outcome"})
+
+	jobRunsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scaler_job_runs_total",
+		Help: "Job runs by job, trigger and outcome.",
+	}, []string{"job", "trigger", "outcome"})
+
+	jobRunDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scaler_job_run_duration_seconds",
+		Help:    "Duration of job runs.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 14),
+	}, []string{"job", "outcome"})
+
+	poolInstancesDesc = prometheus.NewDesc(
+		"scaler_pool_instances",
+		"Instances per status set.",
+		[]string{"status"}, nil,
+	)
+
+	availableInstancesDesc = prometheus.NewDesc(
+		"scaler_pool_available_instances",
+		"Available instances by warm (stopped) or cold (running) state.",
+		[]string{"state"}, nil,
+	)
+)
+
+func outcome(success bool) string {
+	if success {
+		return "success"
+	}
+	return "failure"
+}
+
+// observeOperation records a VMSS operation in the Prometheus metrics
+func observeOperation(event OperationEvent) {
+	operationsTotal.WithLabelValues(event.Operation, outcome(event.Success)).Inc()
+	if event.Duration > 0 {
+		operationDuration.WithLabelValues(event.Operation, outcome(event.Success)).Observe(event.Duration.Seconds())
+	}
+	if !event.Success {
+		operationFailuresTotal.WithLabelValues(event.Operation, event.ErrorClass).Inc()
+	}
+}
+
+// observeDependency records an external call in the Prometheus metrics
+func observeDependency(event DependencyEvent) {
+	dependencyDuration.WithLabelValues(event.Type, event.Name, outcome(event.Success)).Observe(event.Duration.Seconds())
+}
+
+// ObserveJobRun records a single job run
+func ObserveJobRun(job, trigger string, duration time.Duration, err error) {
+	jobRunsTotal.WithLabelValues(job, trigger, outcome(err == nil)).Inc()
+	jobRunDuration.WithLabelValues(job, outcome(err == nil)).Observe(duration.Seconds())
+}
+
+// poolCollector reads the pool sizes from Redis on every scrape
+type poolCollector struct {
+	redis redis.Client
+}
+
+// RegisterPoolCollector exposes the Redis pool sizes as gauges
+func RegisterPoolCollector(redisClient redis.Client) error {
+	return prometheus.Register(&poolCollector{redis: redisClient})
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolInstancesDesc
+	ch <- availableInstancesDesc
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	statusSets := map[vmss.VMStatus]string{
+		vmss.VMStatusAvailable:   redis.VMStatusAvailableSet,
+		vmss.VMStatusReserved:    redis.VMStatusReservedSet,
+		vmss.VMStatusUnavailable: redis.VMStatusUnavailableSet,
+		vmss.VMStatusDeadLetter:  redis.VMStatusDeadLetterSet,
+	}
+
+	for status, set := range statusSets {
+		instances, err := c.redis.SMembers(ctx, set)
+		if err != nil {
+			slog.Warn("Failed to read status set for metrics", "set", set, logging.Err(err))
+			ch <- prometheus.NewInvalidMetric(poolInstancesDesc, err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(poolInstancesDesc, prometheus.GaugeValue, float64(len(instances)), string(status))
+
+		if status == vmss.VMStatusAvailable {
+			c.collectAvailable(ctx, ch, instances)
+		}
+	}
+}
+
+func (c *poolCollector) collectAvailable(ctx context.Context, ch chan<- prometheus.Metric, instances []string) {
+	warm, cold := 0, 0
+	for _, instance := range instances {
+		instanceData, err := c.redis.Get(ctx, instance)
+		if err != nil {
+			continue
+		}
+
+		var record vmss.VMRedisRecord
+		if err := json.Unmarshal([]byte(instanceData), &record); err != nil {
+			continue
+		}
+
+		if record.Warm {
+			warm++
+		} else {
+			cold++
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(availableInstancesDesc, prometheus.GaugeValue, float64(warm), "warm")
+	ch <- prometheus.MustNewConstMetric(availableInstancesDesc, prometheus.GaugeValue, float64(cold), "cold")
+}
+
+// MetricsHandler serves the registered metrics in the Prometheus exposition format
+func MetricsHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ServeMetrics serves /metrics on addr in the background, an empty addr disables the endpoint.
+// The address is bound before returning so a port already in use fails the caller.
+func ServeMetrics(addr string) (*http.Server, error) {
+	if addr == "" {
+		return nil, nil
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", MetricsHandler())
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		slog.Info("Serving metrics", "addr", listener.Addr().String(), "path", "/metrics")
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Failed to serve metrics", logging.Err(err))
+		}
+	}()
+
+	return server, nil
+}
+
+// ShutdownMetrics stops a server returned by ServeMetrics
+func ShutdownMetrics(ctx context.Context, server *http.Server) {
+	if server == nil {
+		return
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Error stopping metrics server", logging.Err(err))
+	}
+}
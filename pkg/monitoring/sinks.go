@@ -0,0 +1,214 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"scaler/pkg/logging"
+	"scaler/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OTLPSink records operation events as spans, exported by the tracing pipeline
+// configured with TRACING_EXPORTER
+type OTLPSink struct{}
+
+func NewOTLPSink() *OTLPSink {
+	return &OTLPSink{}
+}
+
+func (s *OTLPSink) Track(ctx context.Context, event OperationEvent) {
+	// The span covers the operation and is parented on the instance span when there is one
+	_, span := tracing.Start(ctx, "vmss."+event.Operation,
+		trace.WithTimestamp(event.Timestamp.Add(-event.Duration)),
+		trace.WithAttributes(
+			attribute.String("operation.id", event.OperationID),
+			attribute.String("vm.resource_id", event.ResourceID),
+			attribute.String("vm.region", event.Region),
+			attribute.Bool("operation.success", event.Success),
+			attribute.String("job.run_id", event.RunID),
+		),
+	)
+	if !event.Success {
+		span.SetAttributes(attribute.String("error.class", event.ErrorClass))
+		span.SetStatus(codes.Error, event.ErrorMessage)
+	}
+	span.End(trace.WithTimestamp(event.Timestamp))
+}
+
+func (s *OTLPSink) TrackDependency(ctx context.Context, event DependencyEvent) {
+	_, span := tracing.Start(ctx, event.Type+" "+event.Name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(event.Timestamp.Add(-event.Duration)),
+		trace.WithAttributes(
+			attribute.String("peer.service", event.Target),
+			attribute.String("job.run_id", event.RunID),
+		),
+	)
+	if !event.Success {
+		span.SetAttributes(attribute.String("error.class", event.ErrorClass))
+		span.SetStatus(codes.Error, event.ErrorMessage)
+	}
+	span.End(trace.WithTimestamp(event.Timestamp))
+}
+
+func (s *OTLPSink) Close(ctx context.Context) error {
+	// Spans are flushed by the tracing shutdown
+	return nil
+}
+
+// LogSink writes operation events as JSON lines
+type LogSink struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// logRecord is the JSON shape of an operation event
+type logRecord struct {
+	Time         string `json:"time"`
+	Event        string `json:"event"`
+	OperationID  string `json:"operationId"`
+	Operation    string `json:"operation"`
+	ResourceID   string `json:"resourceId,omitempty"`
+	Region       string `json:"region,omitempty"`
+	DurationMs   int64  `json:"durationMs"`
+	Success      bool   `json:"success"`
+	ErrorMessage string `json:"error,omitempty"`
+	ErrorClass   string `json:"errorClass,omitempty"`
+	TraceID      string `json:"traceId,omitempty"`
+	Job          string `json:"job,omitempty"`
+	RunID        string `json:"runId,omitempty"`
+}
+
+// dependencyRecord is the JSON shape of a dependency event
+type dependencyRecord struct {
+	Time         string `json:"time"`
+	Event        string `json:"event"`
+	Type         string `json:"type"`
+	Target       string `json:"target,omitempty"`
+	Name         string `json:"name"`
+	DurationMs   int64  `json:"durationMs"`
+	Success      bool   `json:"success"`
+	ErrorMessage string `json:"error,omitempty"`
+	ErrorClass   string `json:"errorClass,omitempty"`
+	TraceID      string `json:"traceId,omitempty"`
+	Job          string `json:"job,omitempty"`
+	RunID        string `json:"runId,omitempty"`
+}
+
+// NewLogSink creates a sink writing to w, or to stdout when w is nil
+func NewLogSink(w io.Writer) *LogSink {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &LogSink{encoder: json.NewEncoder(w)}
+}
+
+func (s *LogSink) Track(ctx context.Context, event OperationEvent) {
+	record := logRecord{
+		Time:         event.Timestamp.Format(time.RFC3339Nano),
+		Event:        "VMSSOperation",
+		OperationID:  event.OperationID,
+		Operation:    event.Operation,
+		ResourceID:   event.ResourceID,
+		Region:       event.Region,
+		DurationMs:   event.Duration.Milliseconds(),
+		Success:      event.Success,
+		ErrorMessage: event.ErrorMessage,
+		ErrorClass:   event.ErrorClass,
+		TraceID:      event.TraceID,
+		Job:          event.Job,
+		RunID:        event.RunID,
+	}
+	s.write(record)
+}
+
+func (s *LogSink) TrackDependency(ctx context.Context, event DependencyEvent) {
+	record := dependencyRecord{
+		Time:         event.Timestamp.Format(time.RFC3339Nano),
+		Event:        "Dependency",
+		Type:         event.Type,
+		Target:       event.Target,
+		Name:         event.Name,
+		DurationMs:   event.Duration.Milliseconds(),
+		Success:      event.Success,
+		ErrorMessage: event.ErrorMessage,
+		ErrorClass:   event.ErrorClass,
+		TraceID:      event.TraceID,
+		Job:          event.Job,
+		RunID:        event.RunID,
+	}
+	s.write(record)
+}
+
+func (s *LogSink) write(record any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.encoder.Encode(record); err != nil {
+		slog.Error("Failed to write telemetry event", logging.Err(err))
+	}
+}
+
+func (s *LogSink) Close(ctx context.Context) error {
+	return nil
+}
+
+// MemorySink keeps operation events in memory, for tests and local inspection
+type MemorySink struct {
+	mu           sync.Mutex
+	events       []OperationEvent
+	dependencies []DependencyEvent
+	closed       bool
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Track(ctx context.Context, event OperationEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+}
+
+func (s *MemorySink) TrackDependency(ctx context.Context, event DependencyEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dependencies = append(s.dependencies, event)
+}
+
+// Events returns a copy of the events tracked so far
+func (s *MemorySink) Events() []OperationEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]OperationEvent(nil), s.events...)
+}
+
+// Dependencies returns a copy of the dependencies tracked so far
+func (s *MemorySink) Dependencies() []DependencyEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]DependencyEvent(nil), s.dependencies...)
+}
+
+// Closed reports whether the sink was closed
+func (s *MemorySink) Closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *MemorySink) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
@@ -2,51 +2,192 @@ package monitoring
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"scaler/internal/vmss"
+	"log/slog"
 	"time"
 
+	"scaler/internal/vmss"
+	"scaler/pkg/config"
+	"scaler/pkg/logging"
+
 	"github.com/google/uuid"
-	"github.com/microsoft/ApplicationInsights-Go/appinsights"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type Monitor struct {
-	client appinsights.TelemetryClient
+// FlushTimeout bounds flushing buffered telemetry and spans at shutdown
+const FlushTimeout = 10 * time.Second
+
+// Monitor receives the telemetry of VMSS operations
+type Monitor interface {
+	TrackVMSSOperation(ctx context.Context, metrics vmss.VMMetrics, geoName string)
+	TrackDependency(ctx context.Context, dependency Dependency)
+	// Close flushes buffered telemetry
+	Close(ctx context.Context) error
 }
 
-func NewMonitor(instrumentationKey string) (*Monitor, error) {
-	telemetryConfig := appinsights.NewTelemetryConfiguration(instrumentationKey)
+// Sink delivers operation events to a telemetry backend
+type Sink interface {
+	Track(ctx context.Context, event OperationEvent)
+	TrackDependency(ctx context.Context, event DependencyEvent)
+	Close(ctx context.Context) error
+}
 
-	// Configure the client
-	telemetryConfig.MaxBatchSize = 1024
-	telemetryConfig.MaxBatchInterval = time.Second * 2
+// OperationEvent is a single VMSS operation as seen by the sinks
+type OperationEvent struct {
+	OperationID  string
+	Operation    string
+	ResourceID   string
+	Region       string
+	Duration     time.Duration
+	Success      bool
+	ErrorMessage string
+	ErrorClass   string
+	Err          error
+	TraceID      string
+	Job          string
+	RunID        string
+	Timestamp    time.Time
+}
 
-	client := appinsights.NewTelemetryClientFromConfig(telemetryConfig)
+// DependencyEvent is a single external call as seen by the sinks
+type DependencyEvent struct {
+	Type         string
+	Target       string
+	Name         string
+	Duration     time.Duration
+	Success      bool
+	ErrorMessage string
+	ErrorClass   string
+	TraceID      string
+	Job          string
+	RunID        string
+	Timestamp    time.Time
+}
 
-	// Send initial telemetry to verify connection
-	startupEvent := appinsights.NewEventTelemetry("MonitorStartup")
-	startupEvent.Properties["timestamp"] = time.Now().UTC().Format(time.RFC3339)
-	client.Track(startupEvent)
+// fanOut is the Monitor sending every event to all of its sinks
+type fanOut struct {
+	sinks []Sink
+}
 
-	log.Printf("Initialized Application Insights (data may take 2-5 minutes to appear)")
+// NewMonitor creates a monitor sending events to the given sinks, without sinks events are only counted in metrics
+func NewMonitor(sinks ...Sink) Monitor {
+	return &fanOut{sinks: sinks}
+}
 
-	return &Monitor{
-		client: client,
-	}, nil
+// NewSinks creates the sinks selected by config
+func NewSinks(cfg *config.TelemetryConfig, instrumentationKey string) ([]Sink, error) {
+	sinks := make([]Sink, 0, len(cfg.Sinks))
+	for _, name := range cfg.Sinks {
+		switch name {
+		case "appinsights":
+			if instrumentationKey == "" {
+				slog.Warn("Application Insights instrumentation key not set, skipping the appinsights sink")
+				continue
+			}
+			sink, err := NewAppInsightsSink(instrumentationKey)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case "otlp":
+			sinks = append(sinks, NewOTLPSink())
+		case "log":
+			sinks = append(sinks, NewLogSink(nil))
+		case "none":
+		default:
+			return nil, fmt.Errorf("unsupported telemetry sink: %s", name)
+		}
+	}
+	return sinks, nil
 }
 
-func (m *Monitor) TrackVMSSOperation(ctx context.Context, metrics vmss.VMMetrics, geoName string) {
-	operationID := uuid.New().String()
+func (m *fanOut) TrackVMSSOperation(ctx context.Context, metrics vmss.VMMetrics, geoName string) {
+	event := OperationEvent{
+		OperationID:  uuid.New().String(),
+		Operation:    metrics.Operation,
+		ResourceID:   metrics.ResourceID,
+		Region:       metrics.Region,
+		Duration:     metrics.Duration,
+		Success:      metrics.Success,
+		ErrorMessage: metrics.ErrorMessage,
+		Err:          metrics.Err,
+		TraceID:      traceID(ctx),
+		Job:          logging.Job(ctx),
+		RunID:        logging.RunID(ctx),
+		Timestamp:    time.Now().UTC(),
+	}
+	if event.Region == "" {
+		event.Region = geoName
+	}
+
+	// Failures always carry a class, even when only a message was recorded
+	if !event.Success {
+		if event.ErrorMessage == "" && event.Err != nil {
+			event.ErrorMessage = event.Err.Error()
+		}
+		event.ErrorClass = Classify(event.Err)
+		if event.ErrorClass == "" {
+			event.ErrorClass = ErrorClassUnknown
+		}
+	}
 
-	// Custom event for Log Analytics querying
-	event := appinsights.NewEventTelemetry("VMSSOperation")
+	observeOperation(event)
 
-	event.Properties["operationId"] = operationID
-	event.Properties["operation"] = metrics.Operation
-	event.Properties["resourceId"] = metrics.ResourceID
-	event.Properties["region"] = geoName
-	event.Properties["duration"] = fmt.Sprintf("%d", int(metrics.Duration.Seconds()))
+	for _, sink := range m.sinks {
+		deliver(ctx, sink, func() { sink.Track(ctx, event) })
+	}
+}
+
+func (m *fanOut) TrackDependency(ctx context.Context, dependency Dependency) {
+	event := DependencyEvent{
+		Type:       dependency.Type,
+		Target:     dependency.Target,
+		Name:       dependency.Name,
+		Duration:   dependency.Duration,
+		Success:    dependency.Err == nil,
+		ErrorClass: Classify(dependency.Err),
+		TraceID:    traceID(ctx),
+		Job:        logging.Job(ctx),
+		RunID:      logging.RunID(ctx),
+		Timestamp:  time.Now().UTC(),
+	}
+	if dependency.Err != nil {
+		event.ErrorMessage = dependency.Err.Error()
+	}
+
+	observeDependency(event)
+
+	for _, sink := range m.sinks {
+		deliver(ctx, sink, func() { sink.TrackDependency(ctx, event) })
+	}
+}
+
+// Close flushes every sink, a failing sink does not stop the others from flushing
+func (m *fanOut) Close(ctx context.Context) error {
+	var errs []error
+	for _, sink := range m.sinks {
+		if err := sink.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close %T: %w", sink, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deliver sends an event to one sink, so a panicking sink cannot keep it from the others
+func deliver(ctx context.Context, sink Sink, track func()) {
+	defer func() {
+		if p := recover(); p != nil {
+			slog.ErrorContext(ctx, "Telemetry sink panicked", "sink", fmt.Sprintf("%T", sink), "panic", fmt.Sprint(p))
+		}
+	}()
+	track()
+}
 
-	m.client.Track(event)
+// traceID correlates telemetry with the instance trace
+func traceID(ctx context.Context) string {
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		return spanContext.TraceID().String()
+	}
+	return ""
 }
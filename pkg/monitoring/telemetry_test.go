@@ -0,0 +1,74 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"scaler/internal/vmss"
+	"scaler/pkg/logging"
+)
+
+// failingSink panics on every event and fails to close
+type failingSink struct{}
+
+func (failingSink) Track(ctx context.Context, event OperationEvent) {
+	panic("sink unavailable")
+}
+
+func (failingSink) TrackDependency(ctx context.Context, event DependencyEvent) {
+	panic("sink unavailable")
+}
+
+func (failingSink) Close(ctx context.Context) error {
+	return errors.New("flush failed")
+}
+
+func TestMonitorFanOut(t *testing.T) {
+	first, last := NewMemorySink(), NewMemorySink()
+	monitor := NewMonitor(first, failingSink{}, last)
+
+	ctx := logging.WithRun(context.Background(), "starter")
+
+	monitor.TrackVMSSOperation(ctx, vmss.VMMetrics{
+		Operation: "start",
+		Duration:  time.Second,
+		Success:   false,
+		Err:       errors.New("context deadline exceeded"),
+	}, "EUR")
+	monitor.TrackDependency(ctx, Dependency{
+		Type:     DependencyRedis,
+		Name:     "GET",
+		Duration: time.Millisecond,
+	})
+
+	for name, sink := range map[string]*MemorySink{"first": first, "last": last} {
+		events := sink.Events()
+		if len(events) != 1 {
+			t.Fatalf("%s sink got %d events, want 1", name, len(events))
+		}
+		event := events[0]
+		if event.Region != "EUR" {
+			t.Errorf("%s sink Region = %q, want the geo name", name, event.Region)
+		}
+		if event.ErrorClass == "" || event.ErrorMessage == "" {
+			t.Errorf("%s sink failure has no class or message: %+v", name, event)
+		}
+		if event.Job != "starter" || event.RunID != logging.RunID(ctx) {
+			t.Errorf("%s sink Job/RunID = %q/%q, want the run correlation", name, event.Job, event.RunID)
+		}
+
+		if dependencies := sink.Dependencies(); len(dependencies) != 1 || !dependencies[0].Success {
+			t.Errorf("%s sink got dependencies %+v, want one successful call", name, dependencies)
+		}
+	}
+
+	err := monitor.Close(context.Background())
+	if err == nil {
+		t.Error("Close() succeeded, want the failing sink's error")
+	}
+	if !first.Closed() || !last.Closed() {
+		t.Error("Close() did not close every sink")
+	}
+}
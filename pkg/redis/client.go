@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"scaler/pkg/config"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
@@ -20,8 +21,12 @@ const (
 	VMStatusAvailableSet   = "vmss:status:available"
 	VMStatusReservedSet    = "vmss:status:reserved"
 	VMStatusUnavailableSet = "vmss:status:unavailable"
+	VMStatusDeadLetterSet  = "vmss:status:deadletter"
 )
 
+// Nil is returned by Get for a key that does not exist
+const Nil = redis.Nil
+
 type Pipeline interface {
 	Set(ctx context.Context, key, value string) error
 	SAdd(ctx context.Context, key string, member ...string) error
@@ -38,7 +43,18 @@ type Client interface {
 	SPop(ctx context.Context, key string, count int64) ([]string, error)
 	SMembers(ctx context.Context, key string) ([]string, error)
 	Pipeline() Pipeline
+	Publish(ctx context.Context, event Event) error
+	Subscribe(ctx context.Context, opts SubscribeOptions) (Subscription, error)
+	AcquireLease(ctx context.Context, key, owner string, ttl time.Duration) (int64, error)
+	RenewLease(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, key, owner string) error
+	Lock(ctx context.Context, key, owner string, ttl time.Duration) (*Lock, error)
+	LockOwner(ctx context.Context, key string) (string, error)
+	// CheckFence fails with ErrFenced when ctx carries the fencing token of an ended leadership term
+	CheckFence(ctx context.Context) error
 	Ping(ctx context.Context) error
+	// Observe reports commands other than lease and lock traffic to observer, used for dependency telemetry
+	Observe(observer CommandObserver)
 	Close() error
 }
 
@@ -112,6 +128,9 @@ func (r *redisClient) Get(ctx context.Context, key string) (string, error) {
 }
 
 func (r *redisClient) Set(ctx context.Context, key string, value interface{}) error {
+	if f, ok := fenceFrom(ctx); ok {
+		return fencedErr(r.runFenced(ctx, f, [][]interface{}{{"SET", key, value}}).Err())
+	}
 	return r.client.Set(ctx, key, value, 0).Err()
 }
 
@@ -124,7 +143,14 @@ func (r *redisClient) Keys(ctx context.Context, pattern string) ([]string, error
 }
 
 func (c *redisClient) SPop(ctx context.Context, key string, count int64) ([]string, error) {
-	result, err := c.client.SPopN(ctx, key, count).Result()
+	var result []string
+	var err error
+	if f, ok := fenceFrom(ctx); ok {
+		result, err = c.runFenced(ctx, f, [][]interface{}{{"SPOP", key, count}}).StringSlice()
+		err = fencedErr(err)
+	} else {
+		result, err = c.client.SPopN(ctx, key, count).Result()
+	}
 	if err != nil && err != redis.Nil {
 		return nil, fmt.Errorf("failed to pop members from set %s: %w", key, err)
 	}
@@ -140,39 +166,68 @@ func (c *redisClient) SMembers(ctx context.Context, key string) ([]string, error
 }
 
 type redisPipeline struct {
+	client   *redisClient
 	pipeline redis.Pipeliner
+	// commands are kept to replay them behind the fence of a leadership term
+	commands [][]interface{}
 }
 
 func (c *redisClient) Pipeline() Pipeline {
 	pipe := c.client.Pipeline()
-	return &redisPipeline{pipeline: pipe}
+	return &redisPipeline{client: c, pipeline: pipe}
 }
 
 func (p *redisPipeline) Set(ctx context.Context, key, value string) error {
 	p.pipeline.Set(ctx, key, value, 0)
+	p.commands = append(p.commands, []interface{}{"SET", key, value})
 	return nil
 }
 
 func (p *redisPipeline) SAdd(ctx context.Context, key string, members ...string) error {
 	p.pipeline.SAdd(ctx, key, members)
+	p.commands = append(p.commands, command("SADD", key, members))
 	return nil
 }
 
 func (p *redisPipeline) SRem(ctx context.Context, key string, members ...string) error {
 	p.pipeline.SRem(ctx, key, members)
+	p.commands = append(p.commands, command("SREM", key, members))
 	return nil
 }
 
 func (p *redisPipeline) Delete(ctx context.Context, key string) error {
 	p.pipeline.Del(ctx, key)
+	p.commands = append(p.commands, []interface{}{"DEL", key})
 	return nil
 }
 
+// Exec applies the queued commands, atomically and only while still leading when ctx is fenced
 func (p *redisPipeline) Exec(ctx context.Context) error {
+	if f, ok := fenceFrom(ctx); ok {
+		p.pipeline.Discard()
+		if len(p.commands) == 0 {
+			return nil
+		}
+		err := p.client.runFenced(ctx, f, p.commands).Err()
+		if errors.Is(err, redis.Nil) {
+			err = nil
+		}
+		return fencedErr(err)
+	}
+
 	_, err := p.pipeline.Exec(ctx)
 	return err
 }
 
+func command(name, key string, members []string) []interface{} {
+	args := make([]interface{}, 0, len(members)+2)
+	args = append(args, name, key)
+	for _, member := range members {
+		args = append(args, member)
+	}
+	return args
+}
+
 func (c *redisClient) Ping(ctx context.Context) error {
 	result := c.client.Ping(ctx)
 	if result.Err() != nil {
@@ -0,0 +1,201 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"scaler/pkg/logging"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// VMEventsChannel is the pub/sub channel for fire-and-forget listeners
+	VMEventsChannel = "vmss:events"
+	// VMEventsStream keeps recent events so subscribers can resume without gaps
+	VMEventsStream = "vmss:events:stream"
+
+	eventsStreamMaxLen = 10000
+	eventsReadBlock    = 5 * time.Second
+	eventsReadCount    = 100
+	eventsRetryDelay   = time.Second
+)
+
+// EventType represents a VMSS instance status transition
+type EventType string
+
+const (
+	EventAvailable     EventType = "available"
+	EventReserved      EventType = "reserved"
+	EventStarted       EventType = "started"
+	EventReady         EventType = "ready"
+	EventNotReady      EventType = "not_ready"
+	EventCleaned       EventType = "cleaned"
+	EventOrphanRemoved EventType = "orphan_removed"
+	EventDeadLettered  EventType = "dead_lettered"
+
+	// EventUsed is published by the reservation front end when a session ends
+	EventUsed EventType = "used"
+)
+
+// Event is the JSON payload published for every status transition
+type Event struct {
+	ID         string    `json:"id,omitempty"`
+	Type       EventType `json:"type"`
+	Key        string    `json:"key"`
+	VMID       string    `json:"vmId,omitempty"`
+	InstanceID string    `json:"instanceId,omitempty"`
+	SessionID  string    `json:"sessionId,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	Region     string    `json:"region,omitempty"`
+	Timestamp  string    `json:"timestamp"`
+}
+
+type SubscribeOptions struct {
+	// Types filters delivered events, empty means all types
+	Types []EventType
+	// LastID is the stream entry ID to resume after, defaults to the newest entry at the time of
+	// subscribing (new events only)
+	LastID string
+}
+
+// Subscription delivers events until closed
+type Subscription interface {
+	Events() <-chan Event
+	Close() error
+}
+
+func (c *redisClient) Publish(ctx context.Context, event Event) error {
+	if event.Timestamp == "" {
+		event.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", event.Type, err)
+	}
+
+	pipe := c.client.Pipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: VMEventsStream,
+		MaxLen: eventsStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"event": string(payload)},
+	})
+	pipe.Publish(ctx, VMEventsChannel, string(payload))
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to publish %s event for %s: %w", event.Type, event.Key, err)
+	}
+	return nil
+}
+
+type streamSubscription struct {
+	cancel context.CancelFunc
+	events chan Event
+}
+
+func (c *redisClient) Subscribe(ctx context.Context, opts SubscribeOptions) (Subscription, error) {
+	// "$" would be re-resolved by every read and drop events published between reads,
+	// so the newest entry is resolved once and reads always resume after an explicit ID
+	lastID := opts.LastID
+	if lastID == "" || lastID == "$" {
+		id, err := c.lastEventID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		lastID = id
+	}
+
+	types := make(map[EventType]bool)
+	for _, t := range opts.Types {
+		types[t] = true
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &streamSubscription{
+		cancel: cancel,
+		events: make(chan Event, eventsReadCount),
+	}
+
+	go func() {
+		defer close(sub.events)
+
+		for ctx.Err() == nil {
+			streams, err := c.client.XRead(ctx, &redis.XReadArgs{
+				Streams: []string{VMEventsStream, lastID},
+				Count:   eventsReadCount,
+				Block:   eventsReadBlock,
+			}).Result()
+			if err == redis.Nil {
+				continue
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				slog.WarnContext(ctx, "Failed to read events stream", logging.Err(err))
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(eventsRetryDelay):
+				}
+				continue
+			}
+
+			for _, stream := range streams {
+				for _, message := range stream.Messages {
+					lastID = message.ID
+
+					payload, ok := message.Values["event"].(string)
+					if !ok {
+						continue
+					}
+
+					var event Event
+					if err := json.Unmarshal([]byte(payload), &event); err != nil {
+						slog.WarnContext(ctx, "Failed to parse event", "id", message.ID, logging.Err(err))
+						continue
+					}
+					event.ID = message.ID
+
+					if len(types) > 0 && !types[event.Type] {
+						continue
+					}
+
+					select {
+					case sub.events <- event:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return sub, nil
+}
+
+// lastEventID returns the ID of the newest entry of the events stream, or "0-0" while it is empty
+func (c *redisClient) lastEventID(ctx context.Context) (string, error) {
+	messages, err := c.client.XRevRangeN(ctx, VMEventsStream, "+", "-", 1).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to read last event ID: %w", err)
+	}
+	if len(messages) == 0 {
+		return "0-0", nil
+	}
+	return messages[0].ID, nil
+}
+
+func (s *streamSubscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *streamSubscription) Close() error {
+	s.cancel()
+	return nil
+}
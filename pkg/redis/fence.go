@@ -0,0 +1,100 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrFenced is returned when a write carries the fencing token of a leadership term that has ended
+var ErrFenced = errors.New("fencing token is stale, leadership was lost")
+
+// fencedPrefix marks the error reply of fencedScript
+const fencedPrefix = "FENCED"
+
+// fencedScript runs the commands packed in ARGV[2:] (each prefixed by its length, without its key)
+// only while the fence in KEYS[1] still holds the token in ARGV[1], and returns the reply of the
+// last command. The key of the n-th command is KEYS[n+1], so every key is declared to the server.
+var fencedScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return redis.error_reply("FENCED")
+end
+local reply
+local k = 2
+local i = 2
+while i <= #ARGV do
+	local n = tonumber(ARGV[i])
+	reply = redis.call(ARGV[i + 1], KEYS[k], unpack(ARGV, i + 2, i + n))
+	k = k + 1
+	i = i + n + 1
+end
+return reply
+`)
+
+type fenceContextKey struct{}
+
+// fence is the lease and token of the leadership term a context was started in
+type fence struct {
+	key   string
+	token int64
+}
+
+// WithFence returns a context whose writes are only applied while the lease key still
+// carries the given fencing token
+func WithFence(ctx context.Context, leaseKey string, token int64) context.Context {
+	return context.WithValue(ctx, fenceContextKey{}, fence{key: fenceKey(leaseKey), token: token})
+}
+
+// FenceToken returns the fencing token carried by the context, or 0 if writes are not fenced
+func FenceToken(ctx context.Context) int64 {
+	f, _ := ctx.Value(fenceContextKey{}).(fence)
+	return f.token
+}
+
+func fenceFrom(ctx context.Context) (fence, bool) {
+	f, ok := ctx.Value(fenceContextKey{}).(fence)
+	return f, ok
+}
+
+// CheckFence fails with ErrFenced once a newer leadership term has started, used before
+// mutations outside Redis. Contexts without a fence always pass.
+func (c *redisClient) CheckFence(ctx context.Context) error {
+	f, ok := fenceFrom(ctx)
+	if !ok {
+		return nil
+	}
+
+	current, err := c.client.Get(untracked(ctx), f.key).Int64()
+	if err != nil {
+		return fmt.Errorf("failed to read fencing token %s: %w", f.key, err)
+	}
+	if current != f.token {
+		return ErrFenced
+	}
+	return nil
+}
+
+// runFenced applies the commands atomically behind the fence, each command is its name, its key
+// and its arguments
+func (c *redisClient) runFenced(ctx context.Context, f fence, commands [][]interface{}) *redis.Cmd {
+	keys := []string{f.key}
+	args := []interface{}{strconv.FormatInt(f.token, 10)}
+	for _, command := range commands {
+		keys = append(keys, command[1].(string))
+		args = append(args, len(command)-1, command[0])
+		args = append(args, command[2:]...)
+	}
+	return fencedScript.Run(ctx, c.client, keys, args...)
+}
+
+// fencedErr maps the fence error reply to ErrFenced
+func fencedErr(err error) error {
+	if err != nil && strings.HasPrefix(err.Error(), fencedPrefix) {
+		return ErrFenced
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireLeaseScript sets the lease if free and bumps its fencing token
+var acquireLeaseScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0
+`)
+
+// renewLeaseScript extends the lease only while still held by the owner
+var renewLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseLeaseScript deletes the lease only while still held by the owner
+var releaseLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// NewOwnerID returns an identity unique to this process for leases and locks
+func NewOwnerID(name string) string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s:%s:%d:%s", name, hostname, os.Getpid(), uuid.New().String()[:8])
+}
+
+func fenceKey(key string) string {
+	return key + ":fence"
+}
+
+// AcquireLease takes the lease if free and returns its new fencing token, or 0 if it is held
+func (c *redisClient) AcquireLease(ctx context.Context, key, owner string, ttl time.Duration) (int64, error) {
+	token, err := acquireLeaseScript.Run(untracked(ctx), c.client, []string{key, fenceKey(key)}, owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire lease %s: %w", key, err)
+	}
+	return token, nil
+}
+
+// RenewLease extends the lease and reports whether the owner still holds it
+func (c *redisClient) RenewLease(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	renewed, err := renewLeaseScript.Run(untracked(ctx), c.client, []string{key}, owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return false, fmt.Errorf("failed to renew lease %s: %w", key, err)
+	}
+	return renewed == 1, nil
+}
+
+// ReleaseLease gives the lease up if the owner still holds it
+func (c *redisClient) ReleaseLease(ctx context.Context, key, owner string) error {
+	if err := releaseLeaseScript.Run(untracked(ctx), c.client, []string{key}, owner).Err(); err != nil {
+		return fmt.Errorf("failed to release lease %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrLockHeld is returned when another owner holds the lock
+var ErrLockHeld = errors.New("lock held by another owner")
+
+// unlockTimeout bounds releasing a lock after the caller's context is done
+const unlockTimeout = 5 * time.Second
+
+// LockKey returns the lock key guarding an instance record key
+func LockKey(key string) string {
+	return "vmss:lock:" + strings.TrimPrefix(key, "vmss:")
+}
+
+// Lock is an owner-checked lock with a TTL so a crashed owner cannot hold it forever
+type Lock struct {
+	client Client
+	key    string
+	owner  string
+	ttl    time.Duration
+}
+
+func (c *redisClient) Lock(ctx context.Context, key, owner string, ttl time.Duration) (*Lock, error) {
+	lockKey := LockKey(key)
+
+	acquired, err := c.client.SetNX(untracked(ctx), lockKey, owner, ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock %s: %w", lockKey, err)
+	}
+	if !acquired {
+		return nil, fmt.Errorf("failed to acquire lock %s: %w", lockKey, ErrLockHeld)
+	}
+
+	return &Lock{
+		client: c,
+		key:    lockKey,
+		owner:  owner,
+		ttl:    ttl,
+	}, nil
+}
+
+// LockOwner returns the identity currently holding the lock for key, or "" if it is free
+func (c *redisClient) LockOwner(ctx context.Context, key string) (string, error) {
+	owner, err := c.client.Get(untracked(ctx), LockKey(key)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "", fmt.Errorf("failed to get lock owner for %s: %w", key, err)
+	}
+	return owner, nil
+}
+
+// Refresh extends the lock, failing with ErrLockHeld once it has been lost
+func (l *Lock) Refresh(ctx context.Context) error {
+	renewed, err := l.client.RenewLease(ctx, l.key, l.owner, l.ttl)
+	if err != nil {
+		return err
+	}
+	if !renewed {
+		return fmt.Errorf("failed to refresh lock %s: %w", l.key, ErrLockHeld)
+	}
+	return nil
+}
+
+func (l *Lock) Unlock(ctx context.Context) error {
+	return l.client.ReleaseLease(ctx, l.key, l.owner)
+}
+
+// WithLock runs fn while holding the lock for key
+func WithLock(ctx context.Context, c Client, key, owner string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	lock, err := c.Lock(ctx, key, owner, ttl)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Release even when ctx is done, otherwise the record stays locked for the whole TTL
+		unlockCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), unlockTimeout)
+		defer cancel()
+		_ = lock.Unlock(unlockCtx)
+	}()
+
+	// Work must finish before the lock expires and another owner can take over
+	ctx, cancel := context.WithTimeout(ctx, ttl)
+	defer cancel()
+
+	return fn(ctx)
+}
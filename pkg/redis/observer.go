@@ -0,0 +1,89 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CommandObserver is called after every Redis command or pipeline with its outcome
+type CommandObserver func(ctx context.Context, command string, duration time.Duration, err error)
+
+// blockingCommands wait for data, so their duration is not a latency
+var blockingCommands = map[string]bool{
+	"xread":      true,
+	"xreadgroup": true,
+}
+
+type untrackedKey struct{}
+
+// untracked marks coordination traffic (leases and locks) so it is not reported to the observer
+func untracked(ctx context.Context) context.Context {
+	return context.WithValue(ctx, untrackedKey{}, true)
+}
+
+func isUntracked(ctx context.Context) bool {
+	skip, _ := ctx.Value(untrackedKey{}).(bool)
+	return skip
+}
+
+// observerHook reports commands to a CommandObserver
+type observerHook struct {
+	observer CommandObserver
+}
+
+func (c *redisClient) Observe(observer CommandObserver) {
+	c.client.AddHook(observerHook{observer: observer})
+}
+
+func (h observerHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h observerHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+
+		if !blockingCommands[cmd.Name()] && !isUntracked(ctx) {
+			h.observer(ctx, commandName(cmd), time.Since(start), commandErr(err))
+		}
+		return err
+	}
+}
+
+func (h observerHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+
+		if !isUntracked(ctx) {
+			h.observer(ctx, "PIPELINE", time.Since(start), commandErr(err))
+		}
+		return err
+	}
+}
+
+// commandName names a command for telemetry, fenced writes are reported by their role
+// rather than as an anonymous script
+func commandName(cmd redis.Cmder) string {
+	name := cmd.Name()
+	if args := cmd.Args(); name == "evalsha" && len(args) > 1 && args[1] == fencedScript.Hash() {
+		return "FENCED WRITE"
+	}
+	return strings.ToUpper(name)
+}
+
+// commandErr drops the missing key reply, which is an answer rather than a failure
+func commandErr(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	return err
+}
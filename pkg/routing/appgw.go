@@ -0,0 +1,67 @@
+package routing
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"scaler/internal/vmss"
+	"scaler/pkg/appgw"
+)
+
+// AppGWRouter routes instances through Application Gateway path-based rules
+type AppGWRouter struct {
+	mu       sync.Mutex
+	provider appgw.Provider
+}
+
+func NewAppGWRouter(provider appgw.Provider) *AppGWRouter {
+	return &AppGWRouter{
+		provider: provider,
+	}
+}
+
+func (r *AppGWRouter) RegisterInstance(ctx context.Context, instance *vmss.VMInstance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report, err := r.provider.AddInstanceRules(ctx, instance)
+	if err != nil {
+		return err
+	}
+
+	logDrift(ctx, report)
+	return nil
+}
+
+func (r *AppGWRouter) DeregisterInstance(ctx context.Context, instance *vmss.VMInstance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report, err := r.provider.RemoveInstanceRules(ctx, instance)
+	if err != nil {
+		return err
+	}
+
+	logDrift(ctx, report)
+	return nil
+}
+
+func (r *AppGWRouter) Sync(ctx context.Context, instances []*vmss.VMInstance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report, err := r.provider.UpdatePathBasedRules(ctx, sorted(instances))
+	if err != nil {
+		return err
+	}
+
+	logDrift(ctx, report)
+	return nil
+}
+
+func logDrift(ctx context.Context, report *appgw.DriftReport) {
+	if report.HasDrift() {
+		slog.InfoContext(ctx, "Updated path-based rules", "drift", report)
+	}
+}
@@ -0,0 +1,264 @@
+package routing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"text/template"
+
+	"scaler/internal/vmss"
+	"scaler/pkg/config"
+)
+
+// nginxTemplate renders location blocks meant to be included in a server block
+var nginxTemplate = template.Must(template.New("nginx").Parse(`# Generated by scaler, do not edit
+{{- range .Instances}}
+
+location /{{.VMID}}/ {
+    proxy_pass http://{{.PrivateIP}}:{{$.BackendPort}}/;
+    proxy_http_version 1.1;
+    proxy_set_header Upgrade $http_upgrade;
+    proxy_set_header Connection "upgrade";
+    proxy_set_header Host $host;
+    proxy_read_timeout 3600s;
+}
+{{- end}}
+`))
+
+// envoyTemplate renders a static bootstrap with one cluster per instance
+var envoyTemplate = template.Must(template.New("envoy").Parse(`# Generated by scaler, do not edit
+static_resources:
+  listeners:
+  - name: scaler
+    address:
+      socket_address: { address: 0.0.0.0, port_value: {{.ListenPort}} }
+    filter_chains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typed_config:
+          "@type": type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          stat_prefix: scaler
+          upgrade_configs:
+          - upgrade_type: websocket
+          http_filters:
+          - name: envoy.filters.http.router
+            typed_config:
+              "@type": type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          route_config:
+            name: instances
+            virtual_hosts:
+            - name: instances
+              domains: ["*"]
+              routes:
+{{- range .Instances}}
+              - match: { prefix: "/{{.VMID}}/" }
+                route: { cluster: "{{.VMID}}", prefix_rewrite: "/", timeout: 0s }
+{{- end}}
+  clusters:
+{{- range .Instances}}
+  - name: "{{.VMID}}"
+    type: STATIC
+    connect_timeout: 5s
+    load_assignment:
+      cluster_name: "{{.VMID}}"
+      endpoints:
+      - lb_endpoints:
+        - endpoint:
+            address:
+              socket_address: { address: {{.PrivateIP}}, port_value: {{$.BackendPort}} }
+{{- end}}
+`))
+
+// stateSuffix names the file next to the proxy config that lists the routed instances.
+// Single registrations are applied to that list, which is shared by every job writing the config.
+const stateSuffix = ".instances.json"
+
+// FileRouter renders a proxy config file from the instance list and reloads the proxy
+type FileRouter struct {
+	mu       sync.Mutex
+	config   *config.RoutingConfig
+	template *template.Template
+	// reloaded is set once the proxy has loaded the current file, a failed reload is retried
+	// on the next sync even when the rendered config did not change
+	reloaded bool
+}
+
+func NewFileRouter(cfg *config.RoutingConfig) (*FileRouter, error) {
+	// Validate mandatory parameters
+	if cfg.FilePath == "" {
+		return nil, fmt.Errorf("routing file path is required")
+	}
+
+	var tmpl *template.Template
+	switch cfg.FileFormat {
+	case "nginx":
+		tmpl = nginxTemplate
+	case "envoy":
+		tmpl = envoyTemplate
+	default:
+		return nil, fmt.Errorf("unsupported routing file format: %s", cfg.FileFormat)
+	}
+
+	return &FileRouter{
+		config:   cfg,
+		template: tmpl,
+	}, nil
+}
+
+func (r *FileRouter) RegisterInstance(ctx context.Context, instance *vmss.VMInstance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	instances, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	routed := make([]*vmss.VMInstance, 0, len(instances)+1)
+	for _, existing := range instances {
+		if existing.VMID != instance.VMID {
+			routed = append(routed, existing)
+		}
+	}
+	return r.apply(ctx, append(routed, instance))
+}
+
+func (r *FileRouter) DeregisterInstance(ctx context.Context, instance *vmss.VMInstance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	instances, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	routed := make([]*vmss.VMInstance, 0, len(instances))
+	for _, existing := range instances {
+		if existing.VMID != instance.VMID {
+			routed = append(routed, existing)
+		}
+	}
+	return r.apply(ctx, routed)
+}
+
+func (r *FileRouter) Sync(ctx context.Context, instances []*vmss.VMInstance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.apply(ctx, instances)
+}
+
+// load reads the routed instances, none before the first sync
+func (r *FileRouter) load() ([]*vmss.VMInstance, error) {
+	data, err := os.ReadFile(r.config.FilePath + stateSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routed instances: %w", err)
+	}
+
+	var instances []*vmss.VMInstance
+	if err := json.Unmarshal(data, &instances); err != nil {
+		return nil, fmt.Errorf("failed to parse routed instances: %w", err)
+	}
+	return instances, nil
+}
+
+// save records the routed instances for later registrations, by this or another job
+func (r *FileRouter) save(instances []*vmss.VMInstance) error {
+	data, err := json.Marshal(instances)
+	if err != nil {
+		return fmt.Errorf("failed to encode routed instances: %w", err)
+	}
+
+	path := r.config.FilePath + stateSuffix
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, data) {
+		return nil
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write routed instances: %w", err)
+	}
+	return nil
+}
+
+// apply renders the config for the instances, records them and reloads the proxy
+func (r *FileRouter) apply(ctx context.Context, instances []*vmss.VMInstance) error {
+	// Only instances with a private IP can be routed to
+	routable := make([]*vmss.VMInstance, 0, len(instances))
+	for _, instance := range sorted(instances) {
+		if instance.PrivateIP != "" {
+			routable = append(routable, instance)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := r.template.Execute(&buf, struct {
+		Instances   []*vmss.VMInstance
+		BackendPort int
+		ListenPort  int
+	}{routable, r.config.BackendPort, r.config.ListenPort})
+	if err != nil {
+		return fmt.Errorf("failed to render %s config: %w", r.config.FileFormat, err)
+	}
+
+	if err := r.save(routable); err != nil {
+		return err
+	}
+
+	// Skip the reload when nothing changed and the proxy already loaded the file
+	current, err := os.ReadFile(r.config.FilePath)
+	unchanged := err == nil && bytes.Equal(current, buf.Bytes())
+	if unchanged && r.reloaded {
+		slog.DebugContext(ctx, "No changes needed for routes", "format", r.config.FileFormat, "total", len(routable))
+		return nil
+	}
+
+	if !unchanged {
+		if err := writeFileAtomic(r.config.FilePath, buf.Bytes()); err != nil {
+			return fmt.Errorf("failed to write %s config: %w", r.config.FileFormat, err)
+		}
+		slog.InfoContext(ctx, "Updated routes", "format", r.config.FileFormat, "path", r.config.FilePath, "total", len(routable))
+	}
+
+	r.reloaded = false
+	if r.config.ReloadCommand != "" {
+		output, err := exec.CommandContext(ctx, "sh", "-c", r.config.ReloadCommand).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to reload %s: %w: %s", r.config.FileFormat, err, bytes.TrimSpace(output))
+		}
+		slog.InfoContext(ctx, "Reloaded proxy", "format", r.config.FileFormat)
+	}
+
+	r.reloaded = true
+	return nil
+}
+
+// writeFileAtomic replaces the file in one step so the proxy never reads a partial config
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
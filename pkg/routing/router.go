@@ -0,0 +1,48 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"scaler/internal/vmss"
+	"scaler/pkg/appgw"
+	"scaler/pkg/config"
+)
+
+// Router routes client traffic to VMSS instances.
+// Backends keep their routes outside the process, so jobs running in different containers
+// can register and deregister instances of the same pool.
+type Router interface {
+	// RegisterInstance starts routing to an instance, leaving the other routes as they are
+	RegisterInstance(ctx context.Context, instance *vmss.VMInstance) error
+	// DeregisterInstance stops routing to an instance, leaving the other routes as they are
+	DeregisterInstance(ctx context.Context, instance *vmss.VMInstance) error
+	// Sync replaces the routed instances with the given list, reverting any drift
+	Sync(ctx context.Context, instances []*vmss.VMInstance) error
+}
+
+// NewRouter creates the routing backend selected by config
+func NewRouter(cfg *config.RoutingConfig, appgwConfig *config.AppGWConfig) (Router, error) {
+	switch cfg.Backend {
+	case "appgw":
+		provider, err := appgw.NewAzureAppGWProvider(appgwConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create AppGW provider: %w", err)
+		}
+		return NewAppGWRouter(provider), nil
+	case "file":
+		return NewFileRouter(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported routing backend: %s", cfg.Backend)
+	}
+}
+
+// sorted returns the instances in a stable order so unchanged pools render identically
+func sorted(instances []*vmss.VMInstance) []*vmss.VMInstance {
+	list := append([]*vmss.VMInstance(nil), instances...)
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].VMID < list[j].VMID
+	})
+	return list
+}
@@ -0,0 +1,208 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"scaler/internal/vmss"
+	"scaler/pkg/logging"
+	"scaler/pkg/redis"
+)
+
+const (
+	// TokenCookie is the cookie the signalling web app stores the routing token in
+	TokenCookie = "session_token"
+
+	// TokenParam is the query parameter carrying the routing token on the initial request
+	TokenParam = "token"
+)
+
+// ErrSessionRevoked reports a token whose session no longer holds the instance
+var ErrSessionRevoked = errors.New("session is no longer active on this instance")
+
+// RecordStore loads instance records, satisfied by redis.Client. Missing records are reported as redis.Nil.
+type RecordStore interface {
+	Get(ctx context.Context, key string) (string, error)
+}
+
+// Verifier checks routing tokens against the signer and the current instance record
+type Verifier struct {
+	signer          *Signer
+	records         RecordStore
+	trustedProxies  int
+	trustedNetworks []*net.IPNet
+}
+
+// NewVerifier creates a verifier. Forwarding headers are only honoured from peers in trustedCIDRs,
+// and the client address is taken trustedProxies hops from the right of X-Forwarded-For.
+func NewVerifier(signer *Signer, records RecordStore, trustedProxies int, trustedCIDRs []string) (*Verifier, error) {
+	// Validate mandatory parameters
+	if signer == nil {
+		return nil, fmt.Errorf("token signer is required")
+	}
+	if records == nil {
+		return nil, fmt.Errorf("record store is required")
+	}
+	if trustedProxies < 0 {
+		return nil, fmt.Errorf("invalid trusted proxy count: %d, must not be negative", trustedProxies)
+	}
+
+	trustedNetworks := make([]*net.IPNet, 0, len(trustedCIDRs))
+	for _, cidr := range trustedCIDRs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy CIDR %q: %w", cidr, err)
+		}
+		trustedNetworks = append(trustedNetworks, network)
+	}
+
+	return &Verifier{
+		signer:          signer,
+		records:         records,
+		trustedProxies:  trustedProxies,
+		trustedNetworks: trustedNetworks,
+	}, nil
+}
+
+// Verify checks the token and that its session still holds the instance, so tokens are
+// revoked when the instance is cleaned or recycled for another session. The session holds the
+// instance while it is reserved and, once started, while it is unavailable until cleaned.
+func (v *Verifier) Verify(ctx context.Context, token, vmid, clientIP string) (*Claims, error) {
+	claims, err := v.signer.Verify(token, vmid, clientIP)
+	if err != nil {
+		return nil, err
+	}
+
+	instanceData, err := v.records.Get(ctx, instanceKey(vmid))
+	if errors.Is(err, redis.Nil) {
+		// The cleaner deleted the record with the instance
+		return nil, ErrSessionRevoked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance data: %w", err)
+	}
+
+	var record vmss.VMRedisRecord
+	if err := json.Unmarshal([]byte(instanceData), &record); err != nil {
+		return nil, fmt.Errorf("failed to parse instance data: %w", err)
+	}
+
+	active := record.Status == string(vmss.VMStatusReserved) || record.Status == string(vmss.VMStatusUnavailable)
+	if !active || record.SessionID != claims.SessionID {
+		return nil, ErrSessionRevoked
+	}
+	if record.SessionToken != "" && record.SessionToken != token {
+		return nil, ErrSessionRevoked
+	}
+
+	return claims, nil
+}
+
+func instanceKey(vmid string) string {
+	return "vmss:instance:" + vmid
+}
+
+// Handler verifies the routing token of a request forwarded by the gateway or signalling server.
+// It follows the NGINX auth_request convention: the original URI comes in X-Original-URI
+// and the response is 204 for a valid token and 401 otherwise.
+func (v *Verifier) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uri := r.Header.Get("X-Original-URI")
+		if uri == "" {
+			uri = r.URL.RequestURI()
+		}
+
+		original, err := url.ParseRequestURI(uri)
+		if err != nil {
+			http.Error(w, "invalid request URI", http.StatusBadRequest)
+			return
+		}
+
+		// Instances are routed by the first path segment
+		vmid, _, _ := strings.Cut(strings.TrimPrefix(original.Path, "/"), "/")
+
+		token := requestToken(r, original)
+		if token == "" {
+			http.Error(w, "missing token", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := v.Verify(r.Context(), token, vmid, v.clientIP(r))
+		if err != nil {
+			slog.InfoContext(r.Context(), "Rejected request", "vmId", vmid, logging.Err(err))
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("X-Session-ID", claims.SessionID)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func requestToken(r *http.Request, original *url.URL) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if token := original.Query().Get(TokenParam); token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie(TokenCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// clientIP returns the address of the client. Forwarding headers are ignored unless the peer
+// is a trusted proxy, and X-Forwarded-For is read from the right so entries added by the
+// client itself cannot be picked.
+func (v *Verifier) clientIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+
+	if v.trustedProxies == 0 || !v.trusted(peer) {
+		return peer
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	if len(hops) == 0 {
+		return peer
+	}
+
+	// Every trusted proxy appends the address it received the request from
+	hop := hops[max(len(hops)-v.trustedProxies, 0)]
+
+	// Application Gateway appends the client port
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		return host
+	}
+	return hop
+}
+
+func (v *Verifier) trusted(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range v.trustedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrTokenMismatch reports a valid token presented for another instance or client
+var ErrTokenMismatch = errors.New("token is not valid for this instance or client")
+
+// Claims binds a routing token to a single session on a single instance
+type Claims struct {
+	SessionID string `json:"sid"`
+	VMID      string `json:"vmid"`
+	ClientIP  string `json:"cip,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Signer issues and verifies HMAC-signed routing tokens
+type Signer struct {
+	secret []byte
+	issuer string
+	ttl    time.Duration
+}
+
+func NewSigner(secret string, issuer string, ttl time.Duration) (*Signer, error) {
+	// Validate mandatory parameters
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("invalid token secret: must be at least 32 characters")
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invalid token TTL: %v, must be positive", ttl)
+	}
+
+	return &Signer{
+		secret: []byte(secret),
+		issuer: issuer,
+		ttl:    ttl,
+	}, nil
+}
+
+// Issue returns a signed token for the session and its expiry
+func (s *Signer) Issue(sessionID, vmid, clientIP string) (string, time.Time, error) {
+	now := time.Now().UTC()
+	expiresAt := now.Add(s.ttl)
+
+	claims := Claims{
+		SessionID: sessionID,
+		VMID:      vmid,
+		ClientIP:  clientIP,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   sessionID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return token, expiresAt, nil
+}
+
+// Verify checks the token signature and expiry and that it was issued for the instance and client.
+// The client IP is only checked when the token is bound to one.
+func (s *Signer) Verify(token, vmid, clientIP string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify token: %w", err)
+	}
+
+	if claims.VMID != vmid {
+		return nil, ErrTokenMismatch
+	}
+	if claims.ClientIP != "" && claims.ClientIP != clientIP {
+		return nil, ErrTokenMismatch
+	}
+
+	return claims, nil
+}
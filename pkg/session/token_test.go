@@ -0,0 +1,310 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"scaler/internal/vmss"
+	"scaler/pkg/redis"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// memoryRecords is a RecordStore backed by a map
+type memoryRecords map[string]string
+
+func (m memoryRecords) Get(ctx context.Context, key string) (string, error) {
+	value, ok := m[key]
+	if !ok {
+		return "", redis.Nil
+	}
+	return value, nil
+}
+
+func (m memoryRecords) put(t *testing.T, record vmss.VMRedisRecord) {
+	t.Helper()
+	data, err := json.Marshal(record)
+	if err != nil {
+		t.Fatalf("failed to marshal record: %v", err)
+	}
+	m[instanceKey(record.VMID)] = string(data)
+}
+
+func newTestSigner(t *testing.T) *Signer {
+	t.Helper()
+	signer, err := NewSigner(testSecret, "scaler", time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	return signer
+}
+
+// signClaims signs arbitrary claims with the test secret
+func signClaims(t *testing.T, claims Claims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatalf("failed to sign claims: %v", err)
+	}
+	return token
+}
+
+func TestSignerVerify(t *testing.T) {
+	signer := newTestSigner(t)
+
+	valid, _, err := signer.Issue("session-1", "vm-1", "203.0.113.7")
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+	unbound, _, err := signer.Issue("session-1", "vm-1", "")
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	expired := signClaims(t, Claims{
+		SessionID: "session-1",
+		VMID:      "vm-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "scaler",
+			IssuedAt:  jwt.NewNumericDate(past),
+			ExpiresAt: jwt.NewNumericDate(past.Add(time.Minute)),
+		},
+	})
+	otherIssuer := signClaims(t, Claims{
+		SessionID: "session-1",
+		VMID:      "vm-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "someone-else",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+
+	// Keep the signature but swap in the payload of another token
+	validParts := strings.Split(valid, ".")
+	unboundParts := strings.Split(unbound, ".")
+	tampered := strings.Join([]string{validParts[0], unboundParts[1], validParts[2]}, ".")
+
+	tests := []struct {
+		name     string
+		token    string
+		vmid     string
+		clientIP string
+		wantErr  error
+		wantAny  bool
+	}{
+		{name: "valid", token: valid, vmid: "vm-1", clientIP: "203.0.113.7"},
+		{name: "unbound client", token: unbound, vmid: "vm-1", clientIP: "198.51.100.1"},
+		{name: "expired", token: expired, vmid: "vm-1", wantErr: jwt.ErrTokenExpired},
+		{name: "tampered signature", token: tampered, vmid: "vm-1", clientIP: "203.0.113.7", wantErr: jwt.ErrTokenSignatureInvalid},
+		{name: "other issuer", token: otherIssuer, vmid: "vm-1", wantErr: jwt.ErrTokenInvalidIssuer},
+		{name: "malformed", token: "not-a-token", vmid: "vm-1", wantAny: true},
+		{name: "other instance", token: valid, vmid: "vm-2", clientIP: "203.0.113.7", wantErr: ErrTokenMismatch},
+		{name: "other client", token: valid, vmid: "vm-1", clientIP: "198.51.100.1", wantErr: ErrTokenMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := signer.Verify(tt.token, tt.vmid, tt.clientIP)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantAny:
+				if err == nil {
+					t.Fatal("Verify() succeeded, want an error")
+				}
+			default:
+				if err != nil {
+					t.Fatalf("Verify() error = %v", err)
+				}
+				if claims.SessionID != "session-1" {
+					t.Errorf("SessionID = %q, want session-1", claims.SessionID)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifierRevocation(t *testing.T) {
+	signer := newTestSigner(t)
+
+	token, _, err := signer.Issue("session-1", "vm-1", "")
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+	// An earlier token of the same session, replaced when the session was reserved again
+	reissued := signClaims(t, Claims{
+		SessionID: "session-1",
+		VMID:      "vm-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "scaler",
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+
+	reserved := vmss.VMRedisRecord{
+		VMID:         "vm-1",
+		SessionID:    "session-1",
+		SessionToken: token,
+		Status:       string(vmss.VMStatusReserved),
+	}
+
+	tests := []struct {
+		name    string
+		record  *vmss.VMRedisRecord
+		token   string
+		wantErr error
+	}{
+		{name: "reserved session", record: &reserved, token: token},
+		{name: "started session", record: &vmss.VMRedisRecord{
+			VMID: "vm-1", SessionID: "session-1", SessionToken: token,
+			Status: string(vmss.VMStatusUnavailable), Readiness: string(vmss.VMReadinessReady),
+		}, token: token},
+		{name: "recycled for another session", record: &vmss.VMRedisRecord{
+			VMID: "vm-1", SessionID: "session-2", Status: string(vmss.VMStatusReserved),
+		}, token: token, wantErr: ErrSessionRevoked},
+		{name: "started for another session", record: &vmss.VMRedisRecord{
+			VMID: "vm-1", SessionID: "session-2", Status: string(vmss.VMStatusUnavailable),
+		}, token: token, wantErr: ErrSessionRevoked},
+		{name: "released to the pool", record: &vmss.VMRedisRecord{
+			VMID: "vm-1", SessionID: "session-1", Status: string(vmss.VMStatusAvailable),
+		}, token: token, wantErr: ErrSessionRevoked},
+		{name: "recycled", record: &vmss.VMRedisRecord{
+			VMID: "vm-1", Status: string(vmss.VMStatusAvailable),
+		}, token: token, wantErr: ErrSessionRevoked},
+		{name: "cleaned", token: token, wantErr: ErrSessionRevoked},
+		{name: "superseded token", record: &reserved, token: reissued, wantErr: ErrSessionRevoked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := memoryRecords{}
+			if tt.record != nil {
+				records.put(t, *tt.record)
+			}
+
+			verifier, err := NewVerifier(signer, records, 0, nil)
+			if err != nil {
+				t.Fatalf("failed to create verifier: %v", err)
+			}
+
+			_, err = verifier.Verify(context.Background(), tt.token, "vm-1", "")
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("Verify() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifierClientIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies int
+		remoteAddr     string
+		forwardedFor   []string
+		realIP         string
+		want           string
+	}{
+		{name: "direct", trustedProxies: 1, remoteAddr: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "gateway hop", trustedProxies: 1, remoteAddr: "10.0.1.4:5000", forwardedFor: []string{"203.0.113.7:61234"}, want: "203.0.113.7"},
+		{name: "spoofed leftmost entry", trustedProxies: 1, remoteAddr: "10.0.1.4:5000", forwardedFor: []string{"198.51.100.1, 203.0.113.7"}, want: "203.0.113.7"},
+		{name: "spoofed header line", trustedProxies: 1, remoteAddr: "10.0.1.4:5000", forwardedFor: []string{"198.51.100.1", "203.0.113.7"}, want: "203.0.113.7"},
+		{name: "two proxies", trustedProxies: 2, remoteAddr: "10.0.1.4:5000", forwardedFor: []string{"198.51.100.1, 203.0.113.7, 10.0.2.5"}, want: "203.0.113.7"},
+		{name: "untrusted peer", trustedProxies: 1, remoteAddr: "203.0.113.7:5000", forwardedFor: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "headers disabled", trustedProxies: 0, remoteAddr: "10.0.1.4:5000", forwardedFor: []string{"203.0.113.7"}, want: "10.0.1.4"},
+		{name: "real ip ignored", trustedProxies: 1, remoteAddr: "10.0.1.4:5000", realIP: "198.51.100.1", want: "10.0.1.4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := NewVerifier(newTestSigner(t), memoryRecords{}, tt.trustedProxies, []string{"10.0.0.0/8"})
+			if err != nil {
+				t.Fatalf("failed to create verifier: %v", err)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/verify", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, header := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", header)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			if got := verifier.clientIP(r); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifierHandler(t *testing.T) {
+	signer := newTestSigner(t)
+
+	token, _, err := signer.Issue("session-1", "vm-1", "203.0.113.7")
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+
+	records := memoryRecords{}
+	records.put(t, vmss.VMRedisRecord{
+		VMID:         "vm-1",
+		SessionID:    "session-1",
+		SessionToken: token,
+		Status:       string(vmss.VMStatusReserved),
+	})
+
+	verifier, err := NewVerifier(signer, records, 1, []string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("failed to create verifier: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		uri          string
+		forwardedFor string
+		want         int
+	}{
+		{name: "valid", uri: "/vm-1/stream?token=" + token, forwardedFor: "203.0.113.7", want: http.StatusNoContent},
+		{name: "missing token", uri: "/vm-1/stream", forwardedFor: "203.0.113.7", want: http.StatusUnauthorized},
+		{name: "other instance", uri: "/vm-2/stream?token=" + token, forwardedFor: "203.0.113.7", want: http.StatusUnauthorized},
+		{name: "spoofed client", uri: "/vm-1/stream?token=" + token, forwardedFor: "203.0.113.7, 198.51.100.1", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/verify", nil)
+			r.RemoteAddr = "10.0.1.4:5000"
+			r.Header.Set("X-Original-URI", tt.uri)
+			r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+
+			w := httptest.NewRecorder()
+			verifier.Handler().ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, strings.TrimSpace(w.Body.String()))
+			}
+			if tt.want == http.StatusNoContent && w.Header().Get("X-Session-ID") != "session-1" {
+				t.Errorf("X-Session-ID = %q, want session-1", w.Header().Get("X-Session-ID"))
+			}
+		})
+	}
+}
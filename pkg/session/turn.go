@@ -0,0 +1,48 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// TURNCredentials are time-limited credentials for the coturn REST API scheme
+type TURNCredentials struct {
+	Username  string
+	Password  string
+	ExpiresAt time.Time
+}
+
+// TURNIssuer derives per-session TURN credentials from the secret shared with coturn (static-auth-secret)
+type TURNIssuer struct {
+	secret []byte
+}
+
+func NewTURNIssuer(secret string) (*TURNIssuer, error) {
+	// Validate mandatory parameters
+	if secret == "" {
+		return nil, fmt.Errorf("TURN secret is required")
+	}
+
+	return &TURNIssuer{
+		secret: []byte(secret),
+	}, nil
+}
+
+// Issue returns credentials that coturn accepts until expiresAt.
+// The username is "<expiry unix time>:<session ID>" and the password its base64 HMAC-SHA1.
+func (t *TURNIssuer) Issue(sessionID string, expiresAt time.Time) TURNCredentials {
+	username := strconv.FormatInt(expiresAt.Unix(), 10) + ":" + sessionID
+
+	mac := hmac.New(sha1.New, t.secret)
+	mac.Write([]byte(username))
+
+	return TURNCredentials{
+		Username:  username,
+		Password:  base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+		ExpiresAt: expiresAt,
+	}
+}
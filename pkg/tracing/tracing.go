@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"scaler/internal/vmss"
+	"scaler/pkg/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "scaler"
+
+// propagator carries trace contexts between jobs through the Redis records
+var propagator = propagation.TraceContext{}
+
+// Init installs the global tracer provider for a service and returns its shutdown function
+func Init(ctx context.Context, cfg *config.TracingConfig, service string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch cfg.Exporter {
+	case "none", "":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		// The endpoint falls back to the standard OTEL_EXPORTER_OTLP_* variables
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unsupported tracing exporter: %s", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", service),
+		attribute.String("service.namespace", tracerName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(float64(cfg.SamplePercent)/100))),
+	)
+	otel.SetTracerProvider(provider)
+
+	slog.Info("Exporting traces", "service", service, "exporter", cfg.Exporter)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span in the current trace
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// StartInstanceSpan starts a span in the lifecycle trace stored in the record, linked to the
+// current job run. A record without a trace context becomes the root of a new trace.
+func StartInstanceSpan(ctx context.Context, record *vmss.VMRedisRecord, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	opts = append(opts,
+		trace.WithLinks(trace.LinkFromContext(ctx)),
+		trace.WithAttributes(
+			attribute.String("vm.id", record.VMID),
+			attribute.String("vm.instance_id", record.InstanceID),
+			attribute.String("session.id", record.SessionID),
+			attribute.String("vm.region", record.Region),
+		),
+	)
+
+	// Keep the run's cancellation and values, but parent the span on the instance trace
+	parent := trace.ContextWithSpanContext(ctx, trace.SpanContext{})
+	if len(record.TraceContext) > 0 {
+		parent = propagator.Extract(parent, propagation.MapCarrier(record.TraceContext))
+	}
+
+	ctx, span := Start(parent, name, opts...)
+
+	if len(record.TraceContext) == 0 {
+		carrier := propagation.MapCarrier{}
+		propagator.Inject(ctx, carrier)
+		record.TraceContext = carrier
+	}
+
+	return ctx, span
+}
+
+// StartedAt backdates a span to a record timestamp, used for spans covering a wait
+func StartedAt(timestamp string) trace.SpanStartOption {
+	started, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return trace.WithTimestamp(time.Now())
+	}
+	return trace.WithTimestamp(started)
+}
+
+// Finish records the outcome of an operation on its span and ends it
+func Finish(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,59 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"scaler/pkg/config"
+	"scaler/pkg/redis"
+)
+
+func TestEvents(t *testing.T) {
+	// Load Redis configuration
+	cfg, err := config.LoadRedisConfig()
+	if err != nil {
+		t.Fatalf("Failed to load Redis config: %v", err)
+	}
+
+	// Create Redis client
+	client, err := redis.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create Redis client: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Subscribe to ready events only
+	sub, err := client.Subscribe(ctx, redis.SubscribeOptions{
+		Types: []redis.EventType{redis.EventReady},
+	})
+	if err != nil {
+		t.Fatalf("Failed to subscribe to events: %v", err)
+	}
+	defer sub.Close()
+
+	// The subscription is anchored when Subscribe returns, events published from here on are delivered
+	// Publish a filtered and a matching event
+	testKey := "vmss:instance:test-events"
+	if err := client.Publish(ctx, redis.Event{Type: redis.EventStarted, Key: testKey}); err != nil {
+		t.Fatalf("Failed to publish started event: %v", err)
+	}
+	if err := client.Publish(ctx, redis.Event{Type: redis.EventReady, Key: testKey}); err != nil {
+		t.Fatalf("Failed to publish ready event: %v", err)
+	}
+
+	select {
+	case event := <-sub.Events():
+		if event.Type != redis.EventReady || event.Key != testKey {
+			t.Errorf("Expected ready event for %q, got %s for %q", testKey, event.Type, event.Key)
+		}
+		if event.ID == "" {
+			t.Errorf("Expected stream entry ID to be set")
+		}
+	case <-ctx.Done():
+		t.Fatalf("Timed out waiting for ready event")
+	}
+}
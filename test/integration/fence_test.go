@@ -0,0 +1,96 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"scaler/pkg/config"
+	"scaler/pkg/redis"
+)
+
+func TestFence(t *testing.T) {
+	// Load Redis configuration
+	cfg, err := config.LoadRedisConfig()
+	if err != nil {
+		t.Fatalf("Failed to load Redis config: %v", err)
+	}
+
+	// Create Redis client
+	client, err := redis.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create Redis client: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	leaseKey := "vmss:leader:test-fence"
+	testKey := "vmss:instance:test-fence"
+	testSet := "vmss:status:test-fence"
+	defer client.Delete(ctx, testKey)
+
+	// First term
+	oldOwner := redis.NewOwnerID("old")
+	oldToken, err := client.AcquireLease(ctx, leaseKey, oldOwner, 10*time.Second)
+	if err != nil || oldToken == 0 {
+		t.Fatalf("Failed to acquire lease: token %d, %v", oldToken, err)
+	}
+	oldCtx := redis.WithFence(ctx, leaseKey, oldToken)
+
+	// Test fenced writes while leading
+	pipe := client.Pipeline()
+	pipe.Set(oldCtx, testKey, "old")
+	pipe.SAdd(oldCtx, testSet, testKey)
+	if err := pipe.Exec(oldCtx); err != nil {
+		t.Fatalf("Failed to execute fenced pipeline: %v", err)
+	}
+	defer func() {
+		cleanup := client.Pipeline()
+		cleanup.SRem(ctx, testSet, testKey)
+		cleanup.Exec(ctx)
+	}()
+
+	if err := client.CheckFence(oldCtx); err != nil {
+		t.Errorf("Expected fence to hold, got %v", err)
+	}
+
+	// Second term after the first lease is lost
+	if err := client.ReleaseLease(ctx, leaseKey, oldOwner); err != nil {
+		t.Fatalf("Failed to release lease: %v", err)
+	}
+	newOwner := redis.NewOwnerID("new")
+	newToken, err := client.AcquireLease(ctx, leaseKey, newOwner, 10*time.Second)
+	if err != nil || newToken <= oldToken {
+		t.Fatalf("Expected a newer fencing token than %d, got %d, %v", oldToken, newToken, err)
+	}
+	defer client.ReleaseLease(ctx, leaseKey, newOwner)
+
+	// Test writes of the deposed leader
+	if err := client.CheckFence(oldCtx); !errors.Is(err, redis.ErrFenced) {
+		t.Errorf("Expected ErrFenced from CheckFence, got %v", err)
+	}
+	if err := client.Set(oldCtx, testKey, "stale"); !errors.Is(err, redis.ErrFenced) {
+		t.Errorf("Expected ErrFenced from Set, got %v", err)
+	}
+
+	pipe = client.Pipeline()
+	pipe.Set(oldCtx, testKey, "stale")
+	if err := pipe.Exec(oldCtx); !errors.Is(err, redis.ErrFenced) {
+		t.Errorf("Expected ErrFenced from pipeline, got %v", err)
+	}
+
+	value, err := client.Get(ctx, testKey)
+	if err != nil {
+		t.Fatalf("Failed to get value: %v", err)
+	}
+	if value != "old" {
+		t.Errorf("Expected stale writes to be rejected, got %q", value)
+	}
+
+	// Test writes of the new leader
+	newCtx := redis.WithFence(ctx, leaseKey, newToken)
+	if err := client.Set(newCtx, testKey, "new"); err != nil {
+		t.Errorf("Failed to set with current fence: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"scaler/pkg/config"
+	"scaler/pkg/redis"
+)
+
+func TestLock(t *testing.T) {
+	// Load Redis configuration
+	cfg, err := config.LoadRedisConfig()
+	if err != nil {
+		t.Fatalf("Failed to load Redis config: %v", err)
+	}
+
+	// Create Redis client
+	client, err := redis.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create Redis client: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	testKey := "vmss:instance:test-lock"
+	owner := redis.NewOwnerID("test")
+
+	// Test acquire
+	lock, err := client.Lock(ctx, testKey, owner, 10*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+
+	// Test contention
+	if _, err := client.Lock(ctx, testKey, redis.NewOwnerID("other"), 10*time.Second); !errors.Is(err, redis.ErrLockHeld) {
+		t.Errorf("Expected ErrLockHeld for second owner, got %v", err)
+	}
+
+	// Test owner identity
+	current, err := client.LockOwner(ctx, testKey)
+	if err != nil {
+		t.Fatalf("Failed to get lock owner: %v", err)
+	}
+	if current != owner {
+		t.Errorf("Expected owner %q, got %q", owner, current)
+	}
+
+	// Test release
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatalf("Failed to release lock: %v", err)
+	}
+
+	current, err = client.LockOwner(ctx, testKey)
+	if err != nil {
+		t.Fatalf("Failed to get lock owner: %v", err)
+	}
+	if current != "" {
+		t.Errorf("Expected lock to be free, held by %q", current)
+	}
+}